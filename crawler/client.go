@@ -15,7 +15,7 @@
 // This file implements an http.Client with request timeouts set by command
 // line flags. The logic is not perfect, but the code is short.
 
-package main
+package crawler
 
 import (
 	"flag"
@@ -49,4 +49,7 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 var httpTransport = &transport{t: http.Transport{Dial: timeoutDial, ResponseHeaderTimeout: *requestTimeout / 2}}
-var httpClient = &http.Client{Transport: httpTransport}
+
+// HTTPClient is an HTTP client with the timeouts set by the command line
+// flags.
+var HTTPClient = &http.Client{Transport: httpTransport}
@@ -0,0 +1,227 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package crawler fetches package documentation from version control systems
+// and stores the documentation in the database.
+package crawler
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/garyburd/gddo/database"
+	"github.com/garyburd/gddo/doc"
+	"github.com/garyburd/gosrc"
+)
+
+var (
+	MaxAge        = flag.Duration("max_age", 24*time.Hour, "Update package documents older than this age.")
+	crawlRetryMin = flag.Duration("crawl_retry_min", time.Hour, "Retry a crawl that failed with a transient error after this duration. The duration doubles with each consecutive failure.")
+	crawlRetryMax = flag.Duration("crawl_retry_max", 7*24*time.Hour, "Maximum duration between crawl retries. Paths that are not found are retried after this duration.")
+)
+
+var nestedProjectPat = regexp.MustCompile(`/(?:github\.com|launchpad\.net|code\.google\.com/p|bitbucket\.org|labix\.org)/`)
+
+// Crawler crawls packages and stores the results in a database.
+type Crawler struct {
+	db     *database.Database
+	client *http.Client
+
+	// id identifies the crawler in leases.
+	id string
+}
+
+// New returns a crawler that stores documentation in db and fetches files
+// with client.
+func New(db *database.Database, client *http.Client) *Crawler {
+	host, _ := os.Hostname()
+	return &Crawler{db: db, client: client, id: fmt.Sprintf("%s:%d", host, os.Getpid())}
+}
+
+// crawlErrorClass returns the class of a crawl error.
+func crawlErrorClass(err error) string {
+	switch err := err.(type) {
+	case *gosrc.RemoteError:
+		return "remote"
+	case net.Error:
+		if err.Timeout() {
+			return "timeout"
+		}
+	}
+	if gosrc.IsNotFound(err) {
+		return "notfound"
+	}
+	return "error"
+}
+
+// addCrawlError records the failed crawl of importPath.
+func (c *Crawler) addCrawlError(importPath string, err error, t time.Time) *database.CrawlError {
+	class := crawlErrorClass(err)
+	minRetry := *crawlRetryMin
+	if class == "notfound" {
+		minRetry = *crawlRetryMax
+	}
+	e, dbErr := c.db.AddCrawlError(importPath, class, err.Error(), t, minRetry, *crawlRetryMax)
+	if dbErr != nil {
+		log.Printf("ERROR db.AddCrawlError(%q): %v", importPath, dbErr)
+		return nil
+	}
+	errorRate := -1.0
+	if stats, err := c.db.CrawlStats(importPath); err != nil {
+		log.Printf("ERROR db.CrawlStats(%q): %v", importPath, err)
+	} else {
+		errorRate = updateErrorRate(stats.ErrorRate, true)
+	}
+	schedule := fmt.Sprintf("%v: retry after %d failures", e.Retry.Sub(e.Time), e.Attempts)
+	if err := c.db.SetCrawlSchedule(importPath, schedule, -1, errorRate); err != nil {
+		log.Printf("ERROR db.SetCrawlSchedule(%q): %v", importPath, err)
+	}
+	return e
+}
+
+func (c *Crawler) exists(path string) bool {
+	b, err := c.db.Exists(path)
+	if err != nil {
+		b = false
+	}
+	return b
+}
+
+// Crawl fetches the package documentation from the VCS and updates the
+// database. The source is a short label for the log. The pdoc argument is
+// the stored documentation for the package or nil if the package is new.
+func (c *Crawler) Crawl(source string, importPath string, pdoc *doc.Package, hasSubdirs bool, nextCrawl time.Time) (*doc.Package, error) {
+	message := []interface{}{source}
+	defer func() {
+		message = append(message, importPath)
+		log.Println(message...)
+	}()
+
+	if !nextCrawl.IsZero() {
+		d := time.Since(nextCrawl) / time.Hour
+		if d > 0 {
+			message = append(message, "late:", int64(d))
+		}
+	}
+
+	pdocOld := pdoc
+	etag := ""
+	if pdoc != nil {
+		etag = pdoc.Etag
+		message = append(message, "etag:", etag)
+	}
+
+	start := time.Now()
+	var err error
+	if i := strings.Index(importPath, "/src/pkg/"); i > 0 && gosrc.IsGoRepoPath(importPath[i+len("/src/pkg/"):]) {
+		// Go source tree mirror.
+		pdoc = nil
+		err = gosrc.NotFoundError{Message: "Go source tree mirror."}
+	} else if i := strings.Index(importPath, "/libgo/go/"); i > 0 && gosrc.IsGoRepoPath(importPath[i+len("/libgo/go/"):]) {
+		// Go Frontend source tree mirror.
+		pdoc = nil
+		err = gosrc.NotFoundError{Message: "Go Frontend source tree mirror."}
+	} else if m := nestedProjectPat.FindStringIndex(importPath); m != nil && c.exists(importPath[m[0]+1:]) {
+		pdoc = nil
+		err = gosrc.NotFoundError{Message: "Copy of other project."}
+	} else if blocked, e := c.db.IsBlocked(importPath); blocked && e == nil {
+		pdoc = nil
+		err = gosrc.NotFoundError{Message: "Blocked."}
+	} else {
+		var pdocNew *doc.Package
+		pdocNew, err = doc.Get(c.client, importPath, etag)
+		message = append(message, "fetch:", int64(time.Since(start)/time.Millisecond))
+		if err == nil && pdocNew.Name == "" && !hasSubdirs {
+			pdoc = nil
+			err = gosrc.NotFoundError{Message: "No Go files or subdirs"}
+		} else if err != gosrc.ErrNotModified {
+			pdoc = pdocNew
+		}
+	}
+
+	var (
+		schedule   string
+		changeRate = -1.0
+		errorRate  = -1.0
+	)
+	if err == nil || err == gosrc.ErrNotModified {
+		stats, e := c.db.CrawlStats(importPath)
+		if e != nil {
+			log.Printf("ERROR db.CrawlStats(%q): %v", importPath, e)
+			stats = &database.CrawlStats{PopularRank: -1, ChangeRate: -1, ErrorRate: -1}
+		}
+		if pdocOld != nil {
+			stats.ChangeRate = updateChangeRate(stats.ChangeRate, err == nil && pdocOld.Etag != pdoc.Etag)
+		}
+		stats.ErrorRate = updateErrorRate(stats.ErrorRate, false)
+		changeRate = stats.ChangeRate
+		errorRate = stats.ErrorRate
+		var d time.Duration
+		d, schedule = scheduleCrawl(importPath, pdoc, stats, *MaxAge)
+		nextCrawl = start.Add(d)
+	}
+
+	switch {
+	case err == nil:
+		message = append(message, "put:", pdoc.Etag)
+		if err := c.db.Put(pdoc, nextCrawl); err != nil {
+			log.Printf("ERROR db.Put(%q): %v", importPath, err)
+			break
+		}
+		if err := c.db.SetCrawlSchedule(importPath, schedule, changeRate, errorRate); err != nil {
+			log.Printf("ERROR db.SetCrawlSchedule(%q): %v", importPath, err)
+		}
+		if pdocOld != nil && pdocOld.Etag != pdoc.Etag {
+			if changes := doc.DiffAPI(pdocOld, pdoc); len(changes) > 0 {
+				message = append(message, "changes:", len(changes))
+				change := &database.Change{Time: start.UTC(), OldEtag: pdocOld.Etag, NewEtag: pdoc.Etag, Changes: changes}
+				if err := c.db.PutChange(importPath, change); err != nil {
+					log.Printf("ERROR db.PutChange(%q): %v", importPath, err)
+				}
+			}
+		}
+	case err == gosrc.ErrNotModified:
+		message = append(message, "touch")
+		if err := c.db.SetNextCrawlEtag(pdoc.ProjectRoot, pdoc.Etag, nextCrawl); err != nil {
+			log.Printf("ERROR db.SetNextCrawl(%q): %v", importPath, err)
+		}
+		if err := c.db.ClearCrawlError(importPath); err != nil {
+			log.Printf("ERROR db.ClearCrawlError(%q): %v", importPath, err)
+		}
+		if err := c.db.SetCrawlSchedule(importPath, schedule, changeRate, errorRate); err != nil {
+			log.Printf("ERROR db.SetCrawlSchedule(%q): %v", importPath, err)
+		}
+	case gosrc.IsNotFound(err):
+		message = append(message, "notfound:", err)
+		if err := c.db.Delete(importPath); err != nil {
+			log.Printf("ERROR db.Delete(%q): %v", importPath, err)
+		}
+		c.addCrawlError(importPath, err, start)
+	default:
+		message = append(message, "ERROR:", err)
+		if e := c.addCrawlError(importPath, err, start); e != nil {
+			message = append(message, "attempts:", e.Attempts)
+		}
+		return nil, err
+	}
+
+	return pdoc, nil
+}
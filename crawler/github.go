@@ -0,0 +1,54 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package crawler
+
+import (
+	"log"
+	"time"
+
+	"github.com/garyburd/gosrc"
+)
+
+// ReadGitHubUpdates bumps the crawl of the GitHub projects updated since the
+// last call. When several crawlers run, the crawler holding the GitHub
+// updates lease reads the updates and the other crawlers do nothing. The
+// lease is held for the duration lease after the call.
+func (c *Crawler) ReadGitHubUpdates(lease time.Duration) error {
+	if ok, err := c.db.AcquireLease("gitHubUpdates", c.id, lease); err != nil || !ok {
+		return err
+	}
+
+	const key = "gitHubUpdates"
+	var last string
+	if err := c.db.GetGob(key, &last); err != nil {
+		return err
+	}
+	last, names, err := gosrc.GetGitHubUpdates(c.client, last)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		log.Printf("bump crawl github.com/%s", name)
+		if err := c.db.BumpCrawl("github.com/" + name); err != nil {
+			log.Println("ERROR force crawl:", err)
+		}
+	}
+
+	if err := c.db.PutGob(key, last); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// This file implements the concurrent crawler. Workers take packages from
+// the new crawl queue and the next crawl queue. The number of concurrent
+// crawls and the rate of crawls to each VCS host are limited so that the
+// crawler stays within the API budgets of the hosts. The limits are kept in
+// the database and apply to all crawler processes together.
+
+package crawler
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	crawlHosts  = flag.String("crawl_hosts", "github.com=4/2s,bitbucket.org=2/1s,code.google.com=2/1s,*=2/500ms", "Comma separated list of host=concurrency/interval crawl limits. The interval is the minimum time between the start of crawls to the host. The limit for * applies to other hosts. The limits are shared by all crawlers using the database.")
+	crawlLease  = flag.Duration("crawl_lease", time.Hour, "Time that a package taken from the next crawl queue and a crawl slot for its host are reserved for a worker.")
+	crawlWindow = flag.Int("crawl_window", 100, "Number of due packages at the head of the next crawl queue that a worker considers. Packages for hosts at their concurrency limit are skipped.")
+	crawlIdle   = flag.Duration("crawl_idle", time.Second, "Time that a worker waits when no package can be crawled.")
+	crawlReport = flag.Duration("crawl_report", time.Minute, "Interval between crawler throughput reports.")
+)
+
+// hostLimit is the crawl limit for a VCS host.
+type hostLimit struct {
+	concurrency int
+	interval    time.Duration
+}
+
+// parseHostLimits parses the value of the -crawl_hosts flag.
+func parseHostLimits(s string) (map[string]hostLimit, error) {
+	limits := make(map[string]hostLimit)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		i := strings.Index(f, "=")
+		j := strings.Index(f, "/")
+		if i <= 0 || j < i {
+			return nil, fmt.Errorf("crawl hosts: expected host=concurrency/interval, got %q", f)
+		}
+		concurrency, err := strconv.Atoi(f[i+1 : j])
+		if err != nil || concurrency < 1 {
+			return nil, fmt.Errorf("crawl hosts: bad concurrency in %q", f)
+		}
+		interval, err := time.ParseDuration(f[j+1:])
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("crawl hosts: bad interval in %q", f)
+		}
+		limits[f[:i]] = hostLimit{concurrency, interval}
+	}
+	if _, ok := limits["*"]; !ok {
+		return nil, errors.New("crawl hosts: limit for * not specified")
+	}
+	return limits, nil
+}
+
+// crawlHost returns the VCS host for an import path.
+func crawlHost(importPath string) string {
+	if i := strings.Index(importPath, "/"); i >= 0 {
+		return importPath[:i]
+	}
+	return importPath
+}
+
+// hostSlot is a crawl slot for a host held in the database.
+type hostSlot struct {
+	host  string
+	token string
+}
+
+// crawlItem is a package taken from a crawl queue.
+type crawlItem struct {
+	importPath string
+
+	// New packages.
+	isNew      bool
+	hasSubdirs bool
+
+	// Packages in the next crawl queue.
+	nextCrawl time.Time
+}
+
+type crawlPool struct {
+	crawler *Crawler
+	limits  map[string]hostLimit
+
+	mu     sync.Mutex
+	seq    int
+	crawls map[string]int
+	errors map[string]int
+}
+
+func newCrawlPool(c *Crawler, limits map[string]hostLimit) *crawlPool {
+	return &crawlPool{
+		crawler: c,
+		limits:  limits,
+		crawls:  make(map[string]int),
+		errors:  make(map[string]int),
+	}
+}
+
+// acquire reserves a crawl slot for host. If a slot is available, acquire
+// returns the slot and the time to wait before starting the crawl.
+func (p *crawlPool) acquire(host string, now time.Time) (*hostSlot, time.Duration, error) {
+	limit, ok := p.limits[host]
+	if !ok {
+		limit = p.limits["*"]
+	}
+	p.mu.Lock()
+	p.seq++
+	slot := &hostSlot{host: host, token: fmt.Sprintf("%s:%d", p.crawler.id, p.seq)}
+	p.mu.Unlock()
+	wait, ok, err := p.crawler.db.AcquireHostSlot(host, slot.token, limit.concurrency, limit.interval, *crawlLease, now)
+	if err != nil || !ok {
+		return nil, 0, err
+	}
+	return slot, wait, nil
+}
+
+func (p *crawlPool) release(slot *hostSlot) {
+	if err := p.crawler.db.ReleaseHostSlot(slot.host, slot.token); err != nil {
+		log.Printf("ERROR crawler release %s: %v", slot.host, err)
+	}
+}
+
+func (p *crawlPool) record(host string, err error) {
+	p.mu.Lock()
+	p.crawls[host]++
+	if err != nil {
+		p.errors[host]++
+	}
+	p.mu.Unlock()
+}
+
+// report logs and resets the crawl counts.
+func (p *crawlPool) report(d time.Duration) {
+	p.mu.Lock()
+	crawls, errs := p.crawls, p.errors
+	p.crawls = make(map[string]int)
+	p.errors = make(map[string]int)
+	p.mu.Unlock()
+
+	var hosts []string
+	total := 0
+	for host, n := range crawls {
+		hosts = append(hosts, host)
+		total += n
+	}
+	sort.Strings(hosts)
+	var buf []string
+	for _, host := range hosts {
+		buf = append(buf, fmt.Sprintf("%s:%d/%d", host, crawls[host], errs[host]))
+	}
+	log.Printf("Crawler: %d crawls in %v (%.1f/min) %s", total, d, float64(total)/d.Minutes(), strings.Join(buf, " "))
+}
+
+// next returns the next package to crawl and the crawl slot for the
+// package's host or nil if no package is ready. The caller waits for the
+// returned duration before crawling and releases the slot when done.
+// Packages whose host is at its concurrency limit are left in the queue for
+// later calls.
+func (p *crawlPool) next(now time.Time) (*crawlItem, *hostSlot, time.Duration, error) {
+	importPath, hasSubdirs, err := p.crawler.db.PopNewCrawl()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if importPath != "" {
+		slot, wait, err := p.acquire(crawlHost(importPath), now)
+		if slot != nil {
+			return &crawlItem{importPath: importPath, isNew: true, hasSubdirs: hasSubdirs}, slot, wait, nil
+		}
+		// New packages are popped in random order. Return the package
+		// to the set for a later call.
+		if err := p.crawler.db.AddNewCrawl(importPath); err != nil {
+			return nil, nil, 0, err
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	items, err := p.crawler.db.DueCrawls(*crawlWindow)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	full := make(map[string]bool)
+	for _, item := range items {
+		host := crawlHost(item.Path)
+		if full[host] {
+			continue
+		}
+		slot, wait, err := p.acquire(host, now)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if slot == nil {
+			full[host] = true
+			continue
+		}
+		leased, err := p.crawler.db.LeaseCrawl(item, *crawlLease)
+		if err != nil || !leased {
+			p.release(slot)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			continue
+		}
+		return &crawlItem{importPath: item.Path, nextCrawl: item.Time}, slot, wait, nil
+	}
+	return nil, nil, 0, nil
+}
+
+func (p *crawlPool) crawl(item *crawlItem) error {
+	if item.isNew {
+		_, err := p.crawler.Crawl("new", item.importPath, nil, item.hasSubdirs, time.Time{})
+		return err
+	}
+	pdoc, pkgs, _, err := p.crawler.db.Get(item.importPath)
+	if err != nil {
+		return err
+	}
+	_, err = p.crawler.Crawl("crawl", item.importPath, pdoc, len(pkgs) > 0, item.nextCrawl)
+	return err
+}
+
+func (p *crawlPool) worker() {
+	for {
+		item, slot, wait, err := p.next(time.Now())
+		if err != nil {
+			log.Printf("ERROR crawler next: %v", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+		if item == nil {
+			time.Sleep(*crawlIdle)
+			continue
+		}
+		time.Sleep(wait)
+		err = p.crawl(item)
+		p.release(slot)
+		p.record(crawlHost(item.importPath), err)
+	}
+}
+
+// RunPool crawls packages with the given number of concurrent workers using
+// the host limits in the -crawl_hosts flag. RunPool reports the crawler
+// throughput to the log and does not return unless the host limits are not
+// valid.
+func (c *Crawler) RunPool(workers int) error {
+	limits, err := parseHostLimits(*crawlHosts)
+	if err != nil {
+		return err
+	}
+	p := newCrawlPool(c, limits)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	for {
+		time.Sleep(*crawlReport)
+		p.report(*crawlReport)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package crawler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var parseHostLimitsTests = []struct {
+	s      string
+	limits map[string]hostLimit
+}{
+	{"*=1/0s", map[string]hostLimit{"*": {1, 0}}},
+	{"github.com=4/2s, *=2/500ms", map[string]hostLimit{"github.com": {4, 2 * time.Second}, "*": {2, 500 * time.Millisecond}}},
+	{"github.com=4/2s", nil},
+	{"*=0/1s", nil},
+	{"*=1", nil},
+	{"*=1/x", nil},
+}
+
+func TestParseHostLimits(t *testing.T) {
+	for _, tt := range parseHostLimitsTests {
+		limits, err := parseHostLimits(tt.s)
+		if tt.limits == nil {
+			if err == nil {
+				t.Errorf("parseHostLimits(%q) did not return error", tt.s)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(limits, tt.limits) {
+			t.Errorf("parseHostLimits(%q) = %v, %v, want %v", tt.s, limits, err, tt.limits)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package crawler
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/garyburd/gddo/database"
+	"github.com/garyburd/gddo/doc"
+)
+
+const (
+	// Packages ranked below this number in the popular packages do not get
+	// a popularity bonus.
+	popularRanks = 1000
+
+	// Weight of the most recent crawl in the change rate moving average.
+	changeRateWeight = 0.2
+
+	// Change rate assumed for packages crawled for the first time.
+	defaultChangeRate = 0.5
+
+	// Weight of the most recent crawl in the error rate moving average.
+	errorRateWeight = 0.2
+)
+
+// updateChangeRate returns the change rate after a crawl.
+func updateChangeRate(rate float64, changed bool) float64 {
+	if rate < 0 {
+		rate = defaultChangeRate
+	}
+	x := 0.0
+	if changed {
+		x = 1
+	}
+	return (1-changeRateWeight)*rate + changeRateWeight*x
+}
+
+// updateErrorRate returns the error rate after a crawl.
+func updateErrorRate(rate float64, failed bool) float64 {
+	if rate < 0 {
+		rate = 0
+	}
+	x := 0.0
+	if failed {
+		x = 1
+	}
+	return (1-errorRateWeight)*rate + errorRateWeight*x
+}
+
+// scheduleCrawl returns the time from now to the next crawl of a package and
+// a description of the decision. The interval starts at maxAge and is
+// shortened for popular packages, packages with many importers and packages
+// that change often. It is lengthened for packages with a history of failed
+// crawls. Failed crawls are scheduled by the retry backoff.
+func scheduleCrawl(importPath string, pdoc *doc.Package, stats *database.CrawlStats, maxAge time.Duration) (time.Duration, string) {
+	f := 1.0
+	var reasons []string
+
+	if r := stats.PopularRank; r >= 0 && r < popularRanks {
+		f *= 0.25 + 0.75*float64(r)/popularRanks
+		reasons = append(reasons, fmt.Sprintf("popular #%d", r+1))
+	}
+
+	if n := stats.Importers; n > 0 {
+		f /= 1 + math.Log10(float64(n+1))
+		reasons = append(reasons, fmt.Sprintf("%d importers", n))
+	}
+
+	// Scale by 2 for packages that never change down to 1/2 for packages
+	// that change on every crawl.
+	rate := stats.ChangeRate
+	if rate < 0 {
+		rate = defaultChangeRate
+	}
+	f *= math.Pow(2, 1-2*rate)
+	reasons = append(reasons, fmt.Sprintf("change rate %.2f", rate))
+
+	// Scale by up to 4 for packages that fail on every crawl.
+	if rate := stats.ErrorRate; rate > 0 {
+		f *= math.Pow(4, rate)
+		reasons = append(reasons, fmt.Sprintf("error rate %.2f", rate))
+	}
+
+	switch {
+	case strings.HasPrefix(importPath, "gist.github.com/"):
+		// Don't spend time on gists. It's silly thing to do.
+		f *= 30
+		reasons = append(reasons, "gist")
+	case pdoc != nil && len(pdoc.Errors) > 0:
+		f *= 7
+		reasons = append(reasons, "errors")
+	case strings.HasPrefix(importPath, "github.com/"):
+		// GitHub updates bump the crawl of changed projects.
+		f *= 7
+		reasons = append(reasons, "github")
+	}
+
+	d := time.Duration(f * float64(maxAge))
+	if min := maxAge / 4; d < min {
+		d = min
+	} else if max := 30 * maxAge; d > max {
+		d = max
+	}
+	d -= d % time.Minute
+	return d, fmt.Sprintf("%v: %s", d, strings.Join(reasons, ", "))
+}
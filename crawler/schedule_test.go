@@ -0,0 +1,72 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package crawler
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/garyburd/gddo/database"
+	"github.com/garyburd/gddo/doc"
+)
+
+const day = 24 * time.Hour
+
+var scheduleCrawlTests = []struct {
+	importPath string
+	pdoc       *doc.Package
+	stats      database.CrawlStats
+	d          time.Duration
+}{
+	// Unknown change rate uses the default interval.
+	{"example.com/a", nil, database.CrawlStats{PopularRank: -1, ChangeRate: -1}, day},
+	{"example.com/a", nil, database.CrawlStats{PopularRank: -1, ChangeRate: 0}, 2 * day},
+	{"example.com/a", nil, database.CrawlStats{PopularRank: -1, ChangeRate: 1}, day / 2},
+	{"example.com/a", nil, database.CrawlStats{PopularRank: 0, ChangeRate: 0.5}, day / 4},
+	{"example.com/a", nil, database.CrawlStats{PopularRank: -1, Importers: 9, ChangeRate: 0.5}, day / 2},
+	{"example.com/a", &doc.Package{Errors: []string{"error"}}, database.CrawlStats{PopularRank: -1, ChangeRate: 0.5}, 7 * day},
+	{"example.com/a", nil, database.CrawlStats{PopularRank: -1, ChangeRate: 0.5, ErrorRate: 0.5}, 2 * day},
+	{"example.com/a", nil, database.CrawlStats{PopularRank: -1, ChangeRate: 0.5, ErrorRate: 1}, 4 * day},
+	{"github.com/user/repo", nil, database.CrawlStats{PopularRank: -1, ChangeRate: 0.5}, 7 * day},
+	{"gist.github.com/1234.git", nil, database.CrawlStats{PopularRank: -1, ChangeRate: 0}, 30 * day},
+}
+
+func TestScheduleCrawl(t *testing.T) {
+	for _, tt := range scheduleCrawlTests {
+		d, reason := scheduleCrawl(tt.importPath, tt.pdoc, &tt.stats, day)
+		if d != tt.d {
+			t.Errorf("scheduleCrawl(%q, %+v) = %v (%s), want %v", tt.importPath, tt.stats, d, reason, tt.d)
+		}
+	}
+}
+
+func TestUpdateChangeRate(t *testing.T) {
+	if r := updateChangeRate(-1, true); math.Abs(r-0.6) > 1e-9 {
+		t.Errorf("updateChangeRate(-1, true) = %v, want 0.6", r)
+	}
+	if r := updateChangeRate(0.5, false); math.Abs(r-0.4) > 1e-9 {
+		t.Errorf("updateChangeRate(0.5, false) = %v, want 0.4", r)
+	}
+}
+
+func TestUpdateErrorRate(t *testing.T) {
+	if r := updateErrorRate(-1, true); math.Abs(r-0.2) > 1e-9 {
+		t.Errorf("updateErrorRate(-1, true) = %v, want 0.2", r)
+	}
+	if r := updateErrorRate(0.5, false); math.Abs(r-0.4) > 1e-9 {
+		t.Errorf("updateErrorRate(0.5, false) = %v, want 0.4", r)
+	}
+}
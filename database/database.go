@@ -24,15 +24,40 @@
 //      score: document search score
 //      etag:
 //      kind: p=package, c=command, d=directory with no go files
+//      coverage: space separated doc.Coverage counts
+//      deprecated: package deprecation notice
+//      changerate: moving average of the fraction of crawls that found changes
+//      errorrate: moving average of the fraction of crawls that failed
+//      schedule: description of the crawl scheduling decision
+// changes:<id> list: gob encoded API change records, newest first
+// srcs:<id> set: hashes of source files in package
+// src:<hash> string: snappy compressed source file contents
+// srcref:<hash> string: number of packages with source file
 // index:<term> set: package ids for given search term
 // index:import:<path> set: packages with import path
 // index:project:<root> set: packages in project with root
+// index:prefix:<path> set: packages with import path equal to or under path
+// index:use:<path>.<name> set: packages that reference name in package with path
+// methods:<id> hash: type name to kind (i=interface, t=other) and newline separated method signatures, *<name> for the method set of the pointer type
+// index:method:<sig> set: <path>.<name> or <path>.*<name> of non-interface types with method signature
+// index:ifacemethod:<sig> set: <path>.<name> of interfaces with method signature
+// ifacesize zset: <path>.<name> of interface, number of methods in interface
+// implements:<id> hash: cached type name to truncation flag (+ or -) and newline separated <path>.<name> of implementations, expires after implementsTTL
 // block set: packages to block
+// block:<root> hash: reason, created, expires (Unix times, expires is 0 for never)
+// apikey:<key> hash: name, quota, created (Unix time)
+// audit list: JSON encoded admin actions, newest first
+// apikeys set: API keys
 // popular zset: package id, score
 // popular:0 string: scaled base time for popular scores
 // nextCrawl zset: package id, Unix time for next crawl
 // newCrawl set: new paths to crawl
 // badCrawl set: paths that returned error when crawling.
+// lease:<name> string: id of the process holding the lease, expires with the lease
+// local string: present if the database holds the packages of gddo-server -local
+// crawlslots:<host> zset: tokens of crawls in progress to VCS host, Unix time in milliseconds when the slot expires
+// crawlstart:<host> string: Unix time in milliseconds of the earliest start of the next crawl to VCS host
+// crawlerr:<path> hash: class, message, time, attempts, retry (Unix times)
 
 // Package database manages storage for GoPkgDoc.
 package database
@@ -40,6 +65,7 @@ package database
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -65,8 +91,9 @@ type Database struct {
 }
 
 type Package struct {
-	Path     string `json:"path"`
-	Synopsis string `json:"synopsis,omitempty"`
+	Path       string `json:"path"`
+	Synopsis   string `json:"synopsis,omitempty"`
+	Deprecated string `json:"deprecated,omitempty"`
 }
 
 type byPath []Package
@@ -130,6 +157,48 @@ func New() (*Database, error) {
 	return &Database{Pool: pool}, nil
 }
 
+var checkLocalScript = redis.NewScript(0, `
+    local marked = redis.call('EXISTS', 'local') == 1
+    if ARGV[1] ~= '1' then
+        if marked then
+            return 0
+        end
+        return 1
+    end
+    if not marked and redis.call('HLEN', 'ids') > 0 then
+        return 0
+    end
+    redis.call('SET', 'local', '1')
+    return 1
+`)
+
+// CheckLocal returns an error if the database is used both for local
+// packages and for crawled packages. Local packages are stored and indexed
+// like crawled packages, so local mode requires a database of its own. The
+// first use of an empty database in local mode marks it as local.
+func (db *Database) CheckLocal(local bool) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	ok, err := redis.Bool(checkLocalScript.Do(c, local))
+	if err != nil {
+		return err
+	}
+	switch {
+	case !ok && local:
+		return errors.New("database: local mode requires a separate database, this database has crawled packages")
+	case !ok:
+		return errors.New("database: this database has local packages, run gddo-server with -local")
+	}
+	return nil
+}
+
+// Paths returns the import paths of all packages in the database.
+func (db *Database) Paths() ([]string, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	return redis.Strings(c.Do("HKEYS", "ids"))
+}
+
 // Exists returns true if package with import path exists in the database.
 func (db *Database) Exists(path string) (bool, error) {
 	c := db.Pool.Get()
@@ -146,6 +215,8 @@ var putScript = redis.NewScript(0, `
     local etag = ARGV[6]
     local kind = ARGV[7]
     local nextCrawl = ARGV[8]
+    local coverage = ARGV[9]
+    local deprecated = ARGV[10]
 
     local id = redis.call('HGET', 'ids', path)
     if not id then
@@ -175,22 +246,38 @@ var putScript = redis.NewScript(0, `
         end
     end
 
+    local prefix = ''
+    for s in string.gmatch(path, '[^/]+') do
+        prefix = prefix .. s
+        redis.call('SADD', 'index:prefix:' .. prefix, id)
+        prefix = prefix .. '/'
+    end
+
     redis.call('SREM', 'badCrawl', path)
     redis.call('SREM', 'newCrawl', path)
+    redis.call('DEL', 'crawlerr:' .. path)
 
     if nextCrawl ~= '0' then
         redis.call('ZADD', 'nextCrawl', nextCrawl, id)
         redis.call('HSET', 'pkg:' .. id, 'crawl', nextCrawl)
     end
 
-    return redis.call('HMSET', 'pkg:' .. id, 'path', path, 'synopsis', synopsis, 'score', score, 'gob', gob, 'terms', terms, 'etag', etag, 'kind', kind)
+    return redis.call('HMSET', 'pkg:' .. id, 'path', path, 'synopsis', synopsis, 'score', score, 'gob', gob, 'terms', terms, 'etag', etag, 'kind', kind, 'coverage', coverage, 'deprecated', deprecated)
 `)
 
+// addCrawlScript adds the paths in ARGV[2:] to the new crawl queue. Paths
+// with crawl errors are not added until the retry time in ARGV[1] passes.
 var addCrawlScript = redis.NewScript(0, `
-    for i=1,#ARGV do
+    local now = tonumber(ARGV[1])
+    for i=2,#ARGV do
         local pkg = ARGV[i]
-        if redis.call('HEXISTS', 'ids',  pkg) == 0  and redis.call('SISMEMBER', 'badCrawl', pkg) == 0 then
-            redis.call('SADD', 'newCrawl', pkg)
+        if redis.call('HEXISTS', 'ids',  pkg) == 0 then
+            if redis.call('SISMEMBER', 'badCrawl', pkg) == 0 then
+                redis.call('SADD', 'newCrawl', pkg)
+            elseif tonumber(redis.call('HGET', 'crawlerr:' .. pkg, 'retry') or '0') <= now then
+                redis.call('SREM', 'badCrawl', pkg)
+                redis.call('SADD', 'newCrawl', pkg)
+            end
         end
     end
 `)
@@ -201,7 +288,7 @@ func (db *Database) AddNewCrawl(importPath string) error {
 	}
 	c := db.Pool.Get()
 	defer c.Close()
-	_, err := addCrawlScript.Do(c, importPath)
+	_, err := addCrawlScript.Do(c, time.Now().Unix(), importPath)
 	return err
 }
 
@@ -213,6 +300,13 @@ func (db *Database) Put(pdoc *doc.Package, nextCrawl time.Time) error {
 	score := documentScore(pdoc)
 	terms := documentTerms(pdoc, score)
 
+	// The source and method sets are stored separately from the documentation.
+	source := pdoc.Source
+	types := pdoc.Types
+	pdocNew := *pdoc
+	pdoc = &pdocNew
+	pdoc.Source = nil
+
 	var gobBuf bytes.Buffer
 	if err := gob.NewEncoder(&gobBuf).Encode(pdoc); err != nil {
 		return err
@@ -220,8 +314,6 @@ func (db *Database) Put(pdoc *doc.Package, nextCrawl time.Time) error {
 
 	// Truncate large documents.
 	if gobBuf.Len() > 200000 {
-		pdocNew := *pdoc
-		pdoc = &pdocNew
 		pdoc.Truncated = true
 		pdoc.Vars = nil
 		pdoc.Funcs = nil
@@ -252,11 +344,23 @@ func (db *Database) Put(pdoc *doc.Package, nextCrawl time.Time) error {
 		t = nextCrawl.Unix()
 	}
 
-	_, err = putScript.Do(c, pdoc.ImportPath, pdoc.Synopsis, score, gobBytes, strings.Join(terms, " "), pdoc.Etag, kind, t)
+	coverage := fmt.Sprintf("%d %d %d %d", pdoc.Coverage.Exported, pdoc.Coverage.Documented, pdoc.Coverage.ExampleTargets, pdoc.Coverage.WithExamples)
+
+	_, err = putScript.Do(c, pdoc.ImportPath, pdoc.Synopsis, score, gobBytes, strings.Join(terms, " "), pdoc.Etag, kind, t, coverage, pdoc.Deprecated)
 	if err != nil {
 		return err
 	}
 
+	if err := putTypes(c, pdoc.ImportPath, pdoc.Etag, types); err != nil {
+		return err
+	}
+
+	if source != nil {
+		if err := putSource(c, pdoc.ImportPath, source); err != nil {
+			return err
+		}
+	}
+
 	if nextCrawl.IsZero() {
 		// Skip crawling related packages if this is not a full save.
 		return nil
@@ -285,7 +389,8 @@ func (db *Database) Put(pdoc *doc.Package, nextCrawl time.Time) error {
 		paths[pdoc.ImportPath+"/"+p] = true
 	}
 
-	args := make([]interface{}, 0, len(paths))
+	args := make([]interface{}, 0, len(paths)+1)
+	args = append(args, time.Now().Unix())
 	for p := range paths {
 		args = append(args, p)
 	}
@@ -293,6 +398,200 @@ func (db *Database) Put(pdoc *doc.Package, nextCrawl time.Time) error {
 	return err
 }
 
+var putSourceScript = redis.NewScript(0, `
+    local id = redis.call('HGET', 'ids', ARGV[1])
+    if not id then
+        return {}
+    end
+
+    local hashes = {}
+    for i = 2, #ARGV do
+        hashes[ARGV[i]] = true
+    end
+
+    for _, hash in ipairs(redis.call('SMEMBERS', 'srcs:' .. id)) do
+        if not hashes[hash] then
+            redis.call('SREM', 'srcs:' .. id, hash)
+            if redis.call('DECR', 'srcref:' .. hash) <= 0 then
+                redis.call('DEL', 'src:' .. hash, 'srcref:' .. hash)
+            end
+        end
+    end
+
+    local missing = {}
+    for hash in pairs(hashes) do
+        if redis.call('SADD', 'srcs:' .. id, hash) == 1 then
+            redis.call('INCR', 'srcref:' .. hash)
+        end
+        if redis.call('EXISTS', 'src:' .. hash) == 0 then
+            missing[#missing + 1] = hash
+        end
+    end
+    return missing
+`)
+
+// putSource updates the source files for the package with the given import
+// path. Source files are shared between packages with identical files.
+func putSource(c redis.Conn, path string, source map[string][]byte) error {
+	args := []interface{}{path}
+	for hash := range source {
+		args = append(args, hash)
+	}
+	missing, err := redis.Strings(putSourceScript.Do(c, args...))
+	if err != nil {
+		return err
+	}
+	for _, hash := range missing {
+		p, err := snappy.Encode(nil, source[hash])
+		if err != nil {
+			return err
+		}
+		if err := c.Send("SET", "src:"+hash, p); err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		if _, err := c.Do(""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var putTypesScript = redis.NewScript(0, `
+    local path = ARGV[1]
+    local etag = ARGV[2]
+
+    local id = redis.call('HGET', 'ids', path)
+    if not id then
+        return false
+    end
+
+    local key = 'methods:' .. id
+    local old = redis.call('HGETALL', key)
+    for i = 1, #old, 2 do
+        local ref = path .. '.' .. old[i]
+        local kind = string.sub(old[i + 1], 1, 1)
+        for sig in string.gmatch(old[i + 1], '\n([^\n]+)') do
+            if kind == 'i' then
+                redis.call('SREM', 'index:ifacemethod:' .. sig, ref)
+            else
+                redis.call('SREM', 'index:method:' .. sig, ref)
+            end
+        end
+        if kind == 'i' then
+            redis.call('ZREM', 'ifacesize', ref)
+        end
+    end
+    redis.call('DEL', key)
+    redis.call('DEL', 'implements:' .. id)
+
+    if etag ~= '' and etag == redis.call('HGET', 'pkg:' .. id, 'clone') then
+        return false
+    end
+
+    for i = 3, #ARGV, 4 do
+        local name = ARGV[i]
+        local kind = ARGV[i + 1]
+        local ref = path .. '.' .. name
+
+        local sigs = {}
+        for sig in string.gmatch(ARGV[i + 3], '[^\n]+') do
+            sigs[sig] = true
+        end
+
+        -- Add the methods of interfaces embedded from other packages.
+        local ok = true
+        for embedded in string.gmatch(ARGV[i + 2], '[^\n]+') do
+            local epath, ename = string.match(embedded, '^(.*)%.([^.]*)$')
+            local eid = redis.call('HGET', 'ids', epath)
+            local value = eid and redis.call('HGET', 'methods:' .. eid, ename)
+            if not value or string.sub(value, 1, 1) ~= 'i' then
+                ok = false
+                break
+            end
+            for sig in string.gmatch(value, '\n([^\n]+)') do
+                sigs[sig] = true
+            end
+        end
+
+        local list = {}
+        for sig in pairs(sigs) do
+            list[#list + 1] = sig
+        end
+
+        if ok and #list > 0 then
+            table.sort(list)
+            redis.call('HSET', key, name, kind .. '\n' .. table.concat(list, '\n'))
+            for _, sig in ipairs(list) do
+                if kind == 'i' then
+                    redis.call('SADD', 'index:ifacemethod:' .. sig, ref)
+                else
+                    redis.call('SADD', 'index:method:' .. sig, ref)
+                end
+            end
+            if kind == 'i' then
+                redis.call('ZADD', 'ifacesize', #list, ref)
+            end
+        end
+    end
+    return true
+`)
+
+// putTypes updates the method set index for the types in the package with
+// the given import path.
+func putTypes(c redis.Conn, path, etag string, types []*doc.Type) error {
+	args := []interface{}{path, etag}
+	for _, t := range types {
+		if t.MethodSet == nil {
+			continue
+		}
+		kind := "t"
+		if t.IsInterface {
+			kind = "i"
+		}
+		args = append(args, t.Name, kind, strings.Join(t.EmbeddedInterfaces, "\n"), strings.Join(t.MethodSet, "\n"))
+		if t.PtrMethodSet != nil {
+			// The method set of *T is indexed as type *T.
+			args = append(args, "*"+t.Name, kind, "", strings.Join(t.PtrMethodSet, "\n"))
+		}
+	}
+	_, err := putTypesScript.Do(c, args...)
+	return err
+}
+
+// Source returns the contents of the source files with the given hashes. The
+// contents of a file is nil if the file is not found.
+func (db *Database) Source(hashes []string) ([][]byte, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	c := db.Pool.Get()
+	defer c.Close()
+	args := make([]interface{}, len(hashes))
+	for i, hash := range hashes {
+		args[i] = "src:" + hash
+	}
+	values, err := redis.Values(c.Do("MGET", args...))
+	if err != nil {
+		return nil, err
+	}
+	result := make([][]byte, len(values))
+	for i, v := range values {
+		p, err := redis.Bytes(v, nil)
+		if err == redis.ErrNil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result[i], err = snappy.Decode(nil, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
 var setNextCrawlEtagScript = redis.NewScript(0, `
     local root = ARGV[1]
     local etag = ARGV[2]
@@ -413,7 +712,7 @@ func (db *Database) getDoc(c redis.Conn, path string) (*doc.Package, time.Time,
 var getSubdirsScript = redis.NewScript(0, `
     local reply
     for i = 1,#ARGV do
-        reply = redis.call('SORT', 'index:project:' .. ARGV[i], 'ALPHA', 'BY', 'pkg:*->path', 'GET', 'pkg:*->path', 'GET', 'pkg:*->synopsis', 'GET', 'pkg:*->kind')
+        reply = redis.call('SORT', 'index:project:' .. ARGV[i], 'ALPHA', 'BY', 'pkg:*->path', 'GET', 'pkg:*->path', 'GET', 'pkg:*->synopsis', 'GET', 'pkg:*->kind', 'GET', 'pkg:*->deprecated')
         if #reply > 0 then
             break
         end
@@ -455,7 +754,7 @@ func (db *Database) getSubdirs(c redis.Conn, path string, pdoc *doc.Package) ([]
 	for len(values) > 0 {
 		var pkg Package
 		var kind string
-		values, err = redis.Scan(values, &pkg.Path, &pkg.Synopsis, &kind)
+		values, err = redis.Scan(values, &pkg.Path, &pkg.Synopsis, &kind, &pkg.Deprecated)
 		if err != nil {
 			return nil, err
 		}
@@ -508,10 +807,35 @@ var deleteScript = redis.NewScript(0, `
         redis.call('SREM', 'index:' .. term, id)
     end
 
+    local prefix = ''
+    for s in string.gmatch(path, '[^/]+') do
+        prefix = prefix .. s
+        redis.call('SREM', 'index:prefix:' .. prefix, id)
+        prefix = prefix .. '/'
+    end
+
     redis.call('ZREM', 'nextCrawl', id)
     redis.call('SREM', 'newCrawl', path)
     redis.call('ZREM', 'popular', id)
     redis.call('DEL', 'pkg:' .. id)
+    redis.call('DEL', 'changes:' .. id)
+    for _, hash in ipairs(redis.call('SMEMBERS', 'srcs:' .. id)) do
+        if redis.call('DECR', 'srcref:' .. hash) <= 0 then
+            redis.call('DEL', 'src:' .. hash, 'srcref:' .. hash)
+        end
+    end
+    redis.call('DEL', 'srcs:' .. id)
+    local types = redis.call('HGETALL', 'methods:' .. id)
+    for i = 1, #types, 2 do
+        local ref = path .. '.' .. types[i]
+        for sig in string.gmatch(types[i + 1], '\n([^\n]+)') do
+            redis.call('SREM', 'index:ifacemethod:' .. sig, ref)
+            redis.call('SREM', 'index:method:' .. sig, ref)
+        end
+        redis.call('ZREM', 'ifacesize', ref)
+    end
+    redis.call('DEL', 'methods:' .. id)
+    redis.call('DEL', 'implements:' .. id)
     return redis.call('HDEL', 'ids', path)
 `)
 
@@ -528,11 +852,11 @@ func packages(reply interface{}, all bool) ([]Package, error) {
 	if err != nil {
 		return nil, err
 	}
-	result := make([]Package, 0, len(values)/3)
+	result := make([]Package, 0, len(values)/4)
 	for len(values) > 0 {
 		var pkg Package
 		var kind string
-		values, err = redis.Scan(values, &pkg.Path, &pkg.Synopsis, &kind)
+		values, err = redis.Scan(values, &pkg.Path, &pkg.Synopsis, &kind, &pkg.Deprecated)
 		if err != nil {
 			return nil, err
 		}
@@ -550,13 +874,31 @@ func packages(reply interface{}, all bool) ([]Package, error) {
 func (db *Database) getPackages(key string, all bool) ([]Package, error) {
 	c := db.Pool.Get()
 	defer c.Close()
-	reply, err := c.Do("SORT", key, "ALPHA", "BY", "pkg:*->path", "GET", "pkg:*->path", "GET", "pkg:*->synopsis", "GET", "pkg:*->kind")
+	reply, err := c.Do("SORT", key, "ALPHA", "BY", "pkg:*->path", "GET", "pkg:*->path", "GET", "pkg:*->synopsis", "GET", "pkg:*->kind", "GET", "pkg:*->deprecated")
 	if err != nil {
 		return nil, err
 	}
 	return packages(reply, all)
 }
 
+// getPackagesPage returns the page of packages starting at offset in the
+// packages returned by getPackages. More is true if there are packages after
+// the page.
+func (db *Database) getPackagesPage(key string, offset, count int) (pkgs []Package, more bool, err error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(c.Do("SORT", key, "ALPHA", "BY", "pkg:*->path", "LIMIT", offset, count+1, "GET", "pkg:*->path", "GET", "pkg:*->synopsis", "GET", "pkg:*->kind", "GET", "pkg:*->deprecated"))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(values) > 4*count {
+		values = values[:4*count]
+		more = true
+	}
+	pkgs, err = packages(values, false)
+	return pkgs, more, err
+}
+
 func (db *Database) GoIndex() ([]Package, error) {
 	return db.getPackages("index:project:go", false)
 }
@@ -573,6 +915,27 @@ func (db *Database) Project(projectRoot string) ([]Package, error) {
 	return db.getPackages("index:project:"+normalizeProjectRoot(projectRoot), true)
 }
 
+// ProjectCoverage returns the sum of the documentation coverage for the
+// packages in the project.
+func (db *Database) ProjectCoverage(projectRoot string) (doc.Coverage, error) {
+	var result doc.Coverage
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Strings(c.Do("SORT", "index:project:"+normalizeProjectRoot(projectRoot), "GET", "pkg:*->coverage"))
+	if err != nil {
+		return result, err
+	}
+	for _, v := range values {
+		var pc doc.Coverage
+		if _, err := fmt.Sscan(v, &pc.Exported, &pc.Documented, &pc.ExampleTargets, &pc.WithExamples); err != nil {
+			// Package stored before coverage was computed.
+			continue
+		}
+		result.Add(pc)
+	}
+	return result, nil
+}
+
 func (db *Database) AllPackages() ([]Package, error) {
 	c := db.Pool.Get()
 	defer c.Close()
@@ -580,10 +943,60 @@ func (db *Database) AllPackages() ([]Package, error) {
 	if err != nil {
 		return nil, err
 	}
+	return scanAllPackages(values)
+}
+
+// packagesPageScan is the maximum number of package ids examined by
+// PackagesPage. It bounds the work for a page when many ids are unused.
+const packagesPageScan = 10000
+
+var packagesPageScript = redis.NewScript(0, `
+    local after = tonumber(ARGV[1])
+    local count = tonumber(ARGV[2])
+    local scan = tonumber(ARGV[3])
+
+    local max = tonumber(redis.call('GET', 'maxPackageId') or 0)
+    local result = {}
+    local id = after
+    while id < max and id - after < scan and #result < 2 * count do
+        id = id + 1
+        local pkg = redis.call('HMGET', 'pkg:' .. id, 'path', 'kind')
+        if pkg[1] and pkg[2] ~= 'd' then
+            result[#result + 1] = pkg[1]
+            result[#result + 1] = pkg[2] or ''
+        end
+    end
+    if id >= max then
+        id = 0
+    end
+    return {id, result}
+`)
+
+// PackagesPage returns up to count packages with ids greater than after in
+// id order. Ids do not change, so the order is stable as packages are
+// crawled. Directories are omitted from the result. Next is the value of
+// after for the next page or zero if there are no more packages.
+func (db *Database) PackagesPage(after, count int) (pkgs []Package, next int, err error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	reply, err := redis.Values(packagesPageScript.Do(c, after, count, packagesPageScan))
+	if err != nil {
+		return nil, 0, err
+	}
+	var values []interface{}
+	if _, err := redis.Scan(reply, &next, &values); err != nil {
+		return nil, 0, err
+	}
+	pkgs, err = scanAllPackages(values)
+	return pkgs, next, err
+}
+
+func scanAllPackages(values []interface{}) ([]Package, error) {
 	result := make([]Package, 0, len(values)/2)
 	for len(values) > 0 {
 		var pkg Package
 		var kind string
+		var err error
 		values, err = redis.Scan(values, &pkg.Path, &kind)
 		if err != nil {
 			return nil, err
@@ -602,14 +1015,17 @@ var packagesScript = redis.NewScript(0, `
         local path = ARGV[i]
         local synopsis = ''
         local kind = 'u'
+        local deprecated = ''
         local id = redis.call('HGET', 'ids',  path)
         if id then
             synopsis = redis.call('HGET', 'pkg:' .. id, 'synopsis')
             kind = redis.call('HGET', 'pkg:' .. id, 'kind')
+            deprecated = redis.call('HGET', 'pkg:' .. id, 'deprecated') or ''
         end
         result[#result+1] = path
         result[#result+1] = synopsis
         result[#result+1] = kind
+        result[#result+1] = deprecated
     end
     return result
 `)
@@ -640,124 +1056,578 @@ func (db *Database) Importers(path string) ([]Package, error) {
 	return db.getPackages("index:import:"+path, false)
 }
 
-func (db *Database) Block(root string) error {
-	c := db.Pool.Get()
-	defer c.Close()
-	if _, err := c.Do("SADD", "block", root); err != nil {
-		return err
-	}
-	keys, err := redis.Strings(c.Do("HKEYS", "ids"))
-	if err != nil {
-		return err
-	}
-	for _, key := range keys {
-		if key == root || strings.HasPrefix(key, root) && key[len(root)] == '/' {
-			if _, err := deleteScript.Do(c, key); err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+// ImportersPage returns a page of the packages returned by Importers.
+func (db *Database) ImportersPage(path string, offset, count int) ([]Package, bool, error) {
+	return db.getPackagesPage("index:import:"+path, offset, count)
 }
 
-var isBlockedScript = redis.NewScript(0, `
-    local path = ''
-    for s in string.gmatch(ARGV[1], '[^/]+') do
-        path = path .. s
-        if redis.call('SISMEMBER', 'block', path) == 1 then
-            return 1
-        end
-        path = path .. '/'
-    end
-    return  0
-`)
+// UsedBy returns the packages that reference the exported identifier name
+// in the package with the given import path.
+func (db *Database) UsedBy(path, name string) ([]Package, error) {
+	return db.getPackages("index:use:"+path+"."+name, false)
+}
 
-func (db *Database) IsBlocked(path string) (bool, error) {
-	c := db.Pool.Get()
-	defer c.Close()
-	return redis.Bool(isBlockedScript.Do(c, path))
+// UsedByPage returns a page of the packages returned by UsedBy.
+func (db *Database) UsedByPage(path, name string, offset, count int) ([]Package, bool, error) {
+	return db.getPackagesPage("index:use:"+path+"."+name, offset, count)
 }
 
-func (db *Database) Query(q string) ([]Package, error) {
-	terms := parseQuery(q)
-	if len(terms) == 0 {
-		return nil, nil
+// UsageCounts returns the number of packages that reference each of the
+// exported identifiers names in the package with the given import path.
+func (db *Database) UsageCounts(path string, names []string) (map[string]int, error) {
+	result := make(map[string]int)
+	if len(names) == 0 {
+		return result, nil
 	}
 	c := db.Pool.Get()
 	defer c.Close()
-	n, err := redis.Int(c.Do("INCR", "maxQueryId"))
-	if err != nil {
-		return nil, err
-	}
-	id := "tmp:query-" + strconv.Itoa(n)
-
-	args := []interface{}{id}
-	for _, term := range terms {
-		args = append(args, "index:"+term)
+	for _, name := range names {
+		if err := c.Send("SCARD", "index:use:"+path+"."+name); err != nil {
+			return nil, err
+		}
 	}
-	c.Send("SINTERSTORE", args...)
-	c.Send("SORT", id, "DESC", "BY", "pkg:*->score", "GET", "pkg:*->path", "GET", "pkg:*->synopsis", "GET", "pkg:*->kind")
-	c.Send("DEL", id)
-	values, err := redis.Values(c.Do(""))
+	counts, err := redis.Ints(c.Do(""))
 	if err != nil {
 		return nil, err
 	}
-	pkgs, err := packages(values[1], false)
-
-	// Move exact match on standard package to the top of the list.
-	for i, pkg := range pkgs {
-		if !isStandardPackage(pkg.Path) {
-			break
-		}
-		if strings.HasSuffix(pkg.Path, q) {
-			pkgs[0], pkgs[i] = pkgs[i], pkgs[0]
-			break
+	for i, n := range counts {
+		if n > 0 {
+			result[names[i]] = n
 		}
 	}
-	return pkgs, err
+	return result, nil
 }
 
-type PackageInfo struct {
-	PDoc  *doc.Package
-	Pkgs  []Package
-	Score float64
-	Kind  string
-	Size  int
+// TypeRef is a reference to a type declared in a package.
+type TypeRef struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+
+	// Pointer is true if the relation holds for the pointer type *T of the
+	// concrete type T only.
+	Pointer bool `json:"pointer,omitempty"`
 }
 
-// Do executes function f for each document in the database.
-func (db *Database) Do(f func(*PackageInfo) error) error {
-	c := db.Pool.Get()
-	defer c.Close()
-	keys, err := redis.Values(c.Do("KEYS", "pkg:*"))
-	if err != nil {
-		return err
+type byTypeRef struct {
+	path string
+	refs []TypeRef
+}
+
+func (s byTypeRef) Len() int      { return len(s.refs) }
+func (s byTypeRef) Swap(i, j int) { s.refs[i], s.refs[j] = s.refs[j], s.refs[i] }
+func (s byTypeRef) Less(i, j int) bool {
+	// Types in the package come first.
+	if a, b := s.refs[i].Path == s.path, s.refs[j].Path == s.path; a != b {
+		return a
 	}
-	for _, key := range keys {
-		values, err := redis.Values(c.Do("HMGET", key, "gob", "score", "kind", "path", "terms", "synopis"))
-		if err != nil {
-			return err
-		}
+	if s.refs[i].Path != s.refs[j].Path {
+		return s.refs[i].Path < s.refs[j].Path
+	}
+	return s.refs[i].Name < s.refs[j].Name
+}
 
-		var (
-			pi       PackageInfo
-			p        []byte
-			path     string
-			terms    string
-			synopsis string
-		)
+// Limits on the implementation lists computed for a type. Interfaces with
+// common methods such as String() string are implemented by a large part of
+// the corpus. The lists are cached for implementsTTL.
+const (
+	maxImplementations = 100
+	implementsSample   = 1000
+	implementsTTL      = time.Hour
+)
 
-		if _, err := redis.Scan(values, &p, &pi.Score, &pi.Kind, &path, &terms, &synopsis); err != nil {
-			return err
-		}
+var implementationsScript = redis.NewScript(0, `
+    local path = ARGV[1]
+    local limit = tonumber(ARGV[2])
+    local sample = tonumber(ARGV[3])
 
-		if p == nil {
-			continue
-		}
+    local id = redis.call('HGET', 'ids', path)
+    if not id then
+        return {}
+    end
 
-		pi.Size = len(path) + len(p) + len(terms) + len(synopsis)
+    local result = {}
+    local cached = redis.call('HGETALL', 'implements:' .. id)
+    if #cached > 0 then
+        for i = 1, #cached, 2 do
+            if cached[i] ~= '' then
+                -- Skip types in packages deleted after the list was cached.
+                local refs = {}
+                for ref in string.gmatch(cached[i + 1], '\n([^\n]+)') do
+                    local p = string.match(ref, '^(.*)%.[^.]*$')
+                    if p and redis.call('HEXISTS', 'ids', p) == 1 then
+                        refs[#refs + 1] = ref
+                    end
+                end
+                result[#result + 1] = cached[i]
+                result[#result + 1] = string.sub(cached[i + 1], 1, 1)
+                result[#result + 1] = refs
+            end
+        end
+        return {'cached', result}
+    end
 
-		p, err = snappy.Decode(nil, p)
+    local types = redis.call('HGETALL', 'methods:' .. id)
+    local values = {}
+    for i = 1, #types, 2 do
+        values[types[i]] = types[i + 1]
+    end
+
+    for i = 1, #types, 2 do
+        local name = types[i]
+        local sigs = {}
+        for sig in string.gmatch(types[i + 1], '\n([^\n]+)') do
+            sigs[#sigs + 1] = sig
+        end
+        local refs = {}
+        local more = false
+        if string.sub(types[i + 1], 1, 1) == 'i' then
+            -- Types with all of the interface's methods. Sample the smallest
+            -- set and check the sampled types against the other sets.
+            local keys = {}
+            local smallest, size
+            for j, sig in ipairs(sigs) do
+                keys[j] = 'index:method:' .. sig
+                local n = redis.call('SCARD', keys[j])
+                if not size or n < size then
+                    smallest, size = j, n
+                end
+            end
+            more = size > sample
+            for _, ref in ipairs(redis.call('SRANDMEMBER', keys[smallest], sample)) do
+                local ok = true
+                for j, k in ipairs(keys) do
+                    if j ~= smallest and redis.call('SISMEMBER', k, ref) == 0 then
+                        ok = false
+                        break
+                    end
+                end
+                if ok then
+                    refs[#refs + 1] = ref
+                end
+            end
+        else
+            -- Interfaces where the number of methods in common with the type
+            -- is equal to the number of methods in the interface. For *T,
+            -- skip the interfaces implemented by T.
+            local value = {}
+            if string.sub(name, 1, 1) == '*' and values[string.sub(name, 2)] then
+                for sig in string.gmatch(values[string.sub(name, 2)], '\n([^\n]+)') do
+                    value[sig] = true
+                end
+            end
+            local count, valueCount = {}, {}
+            for _, sig in ipairs(sigs) do
+                for _, ref in ipairs(redis.call('SMEMBERS', 'index:ifacemethod:' .. sig)) do
+                    count[ref] = (count[ref] or 0) + 1
+                    if value[sig] then
+                        valueCount[ref] = (valueCount[ref] or 0) + 1
+                    end
+                end
+            end
+            for ref, n in pairs(count) do
+                local size = tonumber(redis.call('ZSCORE', 'ifacesize', ref))
+                if size == n and valueCount[ref] ~= n then
+                    refs[#refs + 1] = ref
+                end
+            end
+        end
+        table.sort(refs)
+        if #refs > limit then
+            more = true
+            for j = #refs, limit + 1, -1 do
+                refs[j] = nil
+            end
+        end
+        if #refs > 0 then
+            local flag = '-'
+            if more then
+                flag = '+'
+            end
+            result[#result + 1] = name
+            result[#result + 1] = flag
+            result[#result + 1] = refs
+        end
+    end
+    return {'computed', result}
+`)
+
+var cacheImplementationsScript = redis.NewScript(0, `
+    local path = ARGV[1]
+    local ttl = ARGV[2]
+
+    local id = redis.call('HGET', 'ids', path)
+    if not id then
+        return false
+    end
+
+    local key = 'implements:' .. id
+    redis.call('DEL', key)
+    -- The empty field marks a cached package without implementations.
+    redis.call('HSET', key, '', '')
+    for i = 3, #ARGV, 2 do
+        redis.call('HSET', key, ARGV[i], ARGV[i + 1])
+    end
+    redis.call('EXPIRE', key, ttl)
+    return true
+`)
+
+// ImplementationList is a list of the types that implement an interface or
+// of the interfaces implemented by a type.
+type ImplementationList struct {
+	Types []TypeRef
+
+	// More is true if the list was truncated.
+	More bool
+}
+
+// Implementations returns the types that implement the interfaces declared
+// in the package with the given import path and the interfaces implemented
+// by the other types declared in the package. The result is keyed by type
+// name. The lists are computed from the types indexed across all packages,
+// cached for a short time and limited in length.
+func (db *Database) Implementations(path string) (map[string]*ImplementationList, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	reply, err := redis.Values(implementationsScript.Do(c, path, maxImplementations, implementsSample))
+	if err != nil || len(reply) == 0 {
+		return nil, err
+	}
+	var (
+		source string
+		values []interface{}
+	)
+	if _, err := redis.Scan(reply, &source, &values); err != nil {
+		return nil, err
+	}
+
+	// The lists are computed in a read-only script because sampling with
+	// SRANDMEMBER is not deterministic. Cache them with a separate script.
+	var args []interface{}
+	if source == "computed" {
+		args = append(args, path, int(implementsTTL/time.Second))
+	}
+
+	lists := make(map[string]*ImplementationList)
+	for i := 0; i+2 < len(values); i += 3 {
+		name, err := redis.String(values[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		flag, err := redis.String(values[i+1], nil)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := redis.Strings(values[i+2], nil)
+		if err != nil {
+			return nil, err
+		}
+		if args != nil {
+			args = append(args, name, flag+"\n"+strings.Join(refs, "\n"))
+		}
+		var types []TypeRef
+		isValue := make(map[string]bool)
+		for _, ref := range refs {
+			j := strings.LastIndex(ref, ".")
+			if j < 0 {
+				continue
+			}
+			t := TypeRef{Path: ref[:j], Name: ref[j+1:]}
+			if strings.HasPrefix(t.Name, "*") {
+				t.Name = t.Name[1:]
+				t.Pointer = true
+			} else {
+				isValue[ref] = true
+			}
+			types = append(types, t)
+		}
+		// Drop *T from the list of an interface when T is also listed.
+		j := 0
+		for _, t := range types {
+			if !t.Pointer || !isValue[t.Path+"."+t.Name] {
+				types[j] = t
+				j++
+			}
+		}
+		lists[name] = &ImplementationList{Types: types[:j], More: flag == "+"}
+	}
+
+	if args != nil {
+		if _, err := cacheImplementationsScript.Do(c, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	// Merge the interfaces implemented by *T only into the list for T.
+	result := make(map[string]*ImplementationList)
+	for name, l := range lists {
+		if strings.HasPrefix(name, "*") {
+			name = name[1:]
+			for i := range l.Types {
+				l.Types[i].Pointer = true
+			}
+		}
+		if r := result[name]; r != nil {
+			r.Types = append(r.Types, l.Types...)
+			r.More = r.More || l.More
+		} else {
+			result[name] = l
+		}
+	}
+	for name, l := range result {
+		if len(l.Types) == 0 {
+			delete(result, name)
+			continue
+		}
+		sort.Sort(byTypeRef{path, l.Types})
+	}
+	return result, nil
+}
+
+// BlockInfo describes a blocked import path prefix.
+type BlockInfo struct {
+	Root    string
+	Reason  string
+	Created time.Time
+
+	// Expires is the time that the block is lifted or the zero time if the
+	// block does not expire.
+	Expires time.Time
+}
+
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnixTime(t int64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0).UTC()
+}
+
+// Block blocks the import path prefix root and deletes the packages under
+// root. The block is lifted at time expires unless expires is the zero time.
+func (db *Database) Block(root, reason string, expires time.Time) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	c.Send("MULTI")
+	c.Send("SADD", "block", root)
+	c.Send("HMSET", "block:"+root, "reason", reason, "created", time.Now().Unix(), "expires", unixTime(expires))
+	if _, err := c.Do("EXEC"); err != nil {
+		return err
+	}
+	paths, err := redis.Strings(c.Do("SORT", "index:prefix:"+root, "BY", "nosort", "GET", "pkg:*->path"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if _, err := deleteScript.Do(c, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unblock removes the block on root and queues root for crawling.
+func (db *Database) Unblock(root string) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	c.Send("MULTI")
+	c.Send("SREM", "block", root)
+	c.Send("DEL", "block:"+root)
+	c.Send("SREM", "badCrawl", root)
+	c.Send("DEL", "crawlerr:"+root)
+	if _, err := c.Do("EXEC"); err != nil {
+		return err
+	}
+	if !gosrc.IsValidRemotePath(root) {
+		return nil
+	}
+	return db.AddNewCrawl(root)
+}
+
+// ListBlocked returns the blocked import path prefixes sorted by root.
+// Blocks created before block reasons were recorded have an empty reason and
+// zero times.
+func (db *Database) ListBlocked() ([]BlockInfo, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(c.Do("SORT", "block", "ALPHA",
+		"GET", "#",
+		"GET", "block:*->reason",
+		"GET", "block:*->created",
+		"GET", "block:*->expires"))
+	if err != nil {
+		return nil, err
+	}
+	var result []BlockInfo
+	for len(values) > 0 {
+		var b BlockInfo
+		var created, expires int64
+		values, err = redis.Scan(values, &b.Root, &b.Reason, &created, &expires)
+		if err != nil {
+			return nil, err
+		}
+		b.Created = fromUnixTime(created)
+		b.Expires = fromUnixTime(expires)
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+// ExpireBlocks unblocks the blocks that expired before now and returns the
+// roots of the lifted blocks.
+func (db *Database) ExpireBlocks(now time.Time) ([]string, error) {
+	blocks, err := db.ListBlocked()
+	if err != nil {
+		return nil, err
+	}
+	var roots []string
+	for _, b := range blocks {
+		if b.Expires.IsZero() || b.Expires.After(now) {
+			continue
+		}
+		if err := db.Unblock(b.Root); err != nil {
+			return roots, err
+		}
+		roots = append(roots, b.Root)
+	}
+	return roots, nil
+}
+
+var isBlockedScript = redis.NewScript(0, `
+    local now = tonumber(ARGV[2])
+    local path = ''
+    for s in string.gmatch(ARGV[1], '[^/]+') do
+        path = path .. s
+        if redis.call('SISMEMBER', 'block', path) == 1 then
+            local expires = tonumber(redis.call('HGET', 'block:' .. path, 'expires') or '0')
+            if expires == 0 or expires > now then
+                return 1
+            end
+        end
+        path = path .. '/'
+    end
+    return  0
+`)
+
+// IsBlocked returns true if path is under an unexpired block.
+func (db *Database) IsBlocked(path string) (bool, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	return redis.Bool(isBlockedScript.Do(c, path, time.Now().Unix()))
+}
+
+// IndexPrefixes adds all packages to the import path prefix index used by
+// Block. Packages are added to the index when stored. This method is used to
+// index packages stored before the index was added.
+func (db *Database) IndexPrefixes() error {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(c.Do("HGETALL", "ids"))
+	if err != nil {
+		return err
+	}
+	for len(values) > 0 {
+		var path, id string
+		values, err = redis.Scan(values, &path, &id)
+		if err != nil {
+			return err
+		}
+		prefix := ""
+		for _, s := range strings.Split(path, "/") {
+			prefix += s
+			c.Send("SADD", "index:prefix:"+prefix, id)
+			prefix += "/"
+		}
+	}
+	_, err = c.Do("")
+	return err
+}
+
+func (db *Database) Query(q string) ([]Package, error) {
+	terms := parseQuery(q)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	c := db.Pool.Get()
+	defer c.Close()
+	n, err := redis.Int(c.Do("INCR", "maxQueryId"))
+	if err != nil {
+		return nil, err
+	}
+	id := "tmp:query-" + strconv.Itoa(n)
+
+	args := []interface{}{id}
+	for _, term := range terms {
+		args = append(args, "index:"+term)
+	}
+	c.Send("SINTERSTORE", args...)
+	c.Send("SORT", id, "DESC", "BY", "pkg:*->score", "GET", "pkg:*->path", "GET", "pkg:*->synopsis", "GET", "pkg:*->kind", "GET", "pkg:*->deprecated")
+	c.Send("DEL", id)
+	values, err := redis.Values(c.Do(""))
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := packages(values[1], false)
+
+	// Move exact match on standard package to the top of the list.
+	for i, pkg := range pkgs {
+		if !isStandardPackage(pkg.Path) {
+			break
+		}
+		if strings.HasSuffix(pkg.Path, q) {
+			pkgs[0], pkgs[i] = pkgs[i], pkgs[0]
+			break
+		}
+	}
+	return pkgs, err
+}
+
+type PackageInfo struct {
+	PDoc  *doc.Package
+	Pkgs  []Package
+	Score float64
+	Kind  string
+	Size  int
+}
+
+// Do executes function f for each document in the database.
+func (db *Database) Do(f func(*PackageInfo) error) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	keys, err := redis.Values(c.Do("KEYS", "pkg:*"))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		values, err := redis.Values(c.Do("HMGET", key, "gob", "score", "kind", "path", "terms", "synopis"))
+		if err != nil {
+			return err
+		}
+
+		var (
+			pi       PackageInfo
+			p        []byte
+			path     string
+			terms    string
+			synopsis string
+		)
+
+		if _, err := redis.Scan(values, &p, &pi.Score, &pi.Kind, &path, &terms, &synopsis); err != nil {
+			return err
+		}
+
+		if p == nil {
+			continue
+		}
+
+		pi.Size = len(path) + len(p) + len(terms) + len(synopsis)
+
+		p, err = snappy.Decode(nil, p)
 		if err != nil {
 			return fmt.Errorf("snappy decoding %s: %v", path, err)
 		}
@@ -867,6 +1737,81 @@ func (db *Database) GetGob(key string, value interface{}) error {
 	return gob.NewDecoder(bytes.NewReader(p)).Decode(value)
 }
 
+// APIKey is a key issued to a client of the API.
+type APIKey struct {
+	Key  string
+	Name string
+
+	// Maximum value of the client's decaying request counter.
+	Quota float64
+
+	Created time.Time
+}
+
+// PutAPIKey adds or replaces an API key.
+func (db *Database) PutAPIKey(k *APIKey) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	c.Send("MULTI")
+	c.Send("HMSET", "apikey:"+k.Key, "name", k.Name, "quota", k.Quota, "created", k.Created.Unix())
+	c.Send("SADD", "apikeys", k.Key)
+	_, err := c.Do("EXEC")
+	return err
+}
+
+// GetAPIKey returns the API key or nil if the key does not exist.
+func (db *Database) GetAPIKey(key string) (*APIKey, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(c.Do("HMGET", "apikey:"+key, "name", "quota", "created"))
+	if err != nil {
+		return nil, err
+	}
+	if values[0] == nil {
+		return nil, nil
+	}
+	k := &APIKey{Key: key}
+	var created int64
+	if _, err := redis.Scan(values, &k.Name, &k.Quota, &created); err != nil {
+		return nil, err
+	}
+	k.Created = time.Unix(created, 0).UTC()
+	return k, nil
+}
+
+// DeleteAPIKey revokes an API key.
+func (db *Database) DeleteAPIKey(key string) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	c.Send("MULTI")
+	c.Send("DEL", "apikey:"+key)
+	c.Send("SREM", "apikeys", key)
+	_, err := c.Do("EXEC")
+	return err
+}
+
+// APIKeys returns all API keys sorted by key.
+func (db *Database) APIKeys() ([]*APIKey, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(c.Do("SORT", "apikeys", "ALPHA", "GET", "#", "GET", "apikey:*->name", "GET", "apikey:*->quota", "GET", "apikey:*->created"))
+	if err != nil {
+		return nil, err
+	}
+	var result []*APIKey
+	for len(values) > 0 {
+		k := &APIKey{}
+		var created int64
+		values, err = redis.Scan(values, &k.Key, &k.Name, &k.Quota, &created)
+		if err != nil {
+			return nil, err
+		}
+		k.Created = time.Unix(created, 0).UTC()
+		result = append(result, k)
+	}
+	return result, nil
+}
+
 var incrementPopularScoreScript = redis.NewScript(0, `
     local path = ARGV[1]
     local n = ARGV[2]
@@ -909,10 +1854,11 @@ var popularScript = redis.NewScript(0, `
     local ids = redis.call('ZREVRANGE', 'popular', '0', stop)
     local result = {}
     for i=1,#ids do
-        local values = redis.call('HMGET', 'pkg:' .. ids[i], 'path', 'synopsis', 'kind')
+        local values = redis.call('HMGET', 'pkg:' .. ids[i], 'path', 'synopsis', 'kind', 'deprecated')
         result[#result+1] = values[1]
         result[#result+1] = values[2]
         result[#result+1] = values[3]
+        result[#result+1] = values[4]
     end
     return result
 `)
@@ -935,6 +1881,7 @@ var popularWithScoreScript = redis.NewScript(0, `
         result[#result+1] = redis.call('HGET', 'pkg:' .. ids[i], 'path')
         result[#result+1] = ids[i+1]
         result[#result+1] = 'p'
+        result[#result+1] = ''
     end
     return result
 `)
@@ -974,6 +1921,582 @@ func (db *Database) AddBadCrawl(path string) error {
 	return err
 }
 
+var dueCrawlsScript = redis.NewScript(0, `
+    local r = redis.call('ZRANGEBYSCORE', 'nextCrawl', '-inf', ARGV[1], 'WITHSCORES', 'LIMIT', 0, ARGV[2])
+    local result = {}
+    for i = 1, #r, 2 do
+        result[#result + 1] = redis.call('HGET', 'pkg:' .. r[i], 'path') or ''
+        result[#result + 1] = r[i + 1]
+    end
+    return result
+`)
+
+// DueCrawls returns up to n packages in the next crawl queue that are due for
+// crawling, in order of scheduled crawl time.
+func (db *Database) DueCrawls(n int) ([]CrawlItem, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(dueCrawlsScript.Do(c, time.Now().Unix(), n))
+	if err != nil {
+		return nil, err
+	}
+	var items []CrawlItem
+	for len(values) > 0 {
+		var (
+			path string
+			t    int64
+		)
+		values, err = redis.Scan(values, &path, &t)
+		if err != nil {
+			return nil, err
+		}
+		if path != "" {
+			items = append(items, CrawlItem{Path: path, Time: time.Unix(t, 0).UTC()})
+		}
+	}
+	return items, nil
+}
+
+var leaseCrawlScript = redis.NewScript(0, `
+    local id = redis.call('HGET', 'ids', ARGV[1])
+    if not id then
+        return 0
+    end
+    local score = redis.call('ZSCORE', 'nextCrawl', id)
+    if not score or tonumber(score) ~= tonumber(ARGV[2]) then
+        return 0
+    end
+    redis.call('ZADD', 'nextCrawl', ARGV[3], id)
+    return 1
+`)
+
+// LeaseCrawl reserves a package returned by DueCrawls by moving the package
+// back in the next crawl queue by the lease duration. The crawler
+// reschedules the package when the crawl is complete. LeaseCrawl returns
+// false if the package was rescheduled or leased by another crawler since
+// the call to DueCrawls.
+func (db *Database) LeaseCrawl(item CrawlItem, lease time.Duration) (bool, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	return redis.Bool(leaseCrawlScript.Do(c, item.Path, item.Time.Unix(), time.Now().Add(lease).Unix()))
+}
+
+var acquireLeaseScript = redis.NewScript(0, `
+    local key = 'lease:' .. ARGV[1]
+    local owner = redis.call('GET', key)
+    if owner and owner ~= ARGV[2] then
+        return 0
+    end
+    redis.call('SET', key, ARGV[2])
+    redis.call('EXPIRE', key, ARGV[3])
+    return 1
+`)
+
+// AcquireLease acquires or renews the lease with the given name for owner.
+// AcquireLease returns false if another owner holds the lease. Leases are
+// used to select one of several processes to run a task.
+func (db *Database) AcquireLease(name, owner string, ttl time.Duration) (bool, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	return redis.Bool(acquireLeaseScript.Do(c, name, owner, int64(ttl/time.Second)))
+}
+
+var acquireHostSlotScript = redis.NewScript(0, `
+    local host = ARGV[1]
+    local token = ARGV[2]
+    local concurrency = tonumber(ARGV[3])
+    local interval = tonumber(ARGV[4])
+    local lease = tonumber(ARGV[5])
+    local now = tonumber(ARGV[6])
+
+    local slots = 'crawlslots:' .. host
+    redis.call('ZREMRANGEBYSCORE', slots, '-inf', now)
+    if redis.call('ZCARD', slots) >= concurrency then
+        return false
+    end
+    redis.call('ZADD', slots, now + lease, token)
+    redis.call('PEXPIRE', slots, lease)
+
+    local key = 'crawlstart:' .. host
+    local start = tonumber(redis.call('GET', key) or now)
+    if start < now then
+        start = now
+    end
+    redis.call('SET', key, string.format('%.0f', start + interval))
+    redis.call('PEXPIRE', key, start + interval - now + 1)
+    return start - now
+`)
+
+// AcquireHostSlot reserves one of the concurrency crawl slots for a VCS host
+// and spaces the starts of crawls to the host by interval. The slots are
+// shared by all crawler processes using the database. A slot is held until
+// ReleaseHostSlot is called with the same token or until lease expires.
+// AcquireHostSlot returns false if all slots are held. Otherwise, it returns
+// the time to wait before starting the crawl.
+func (db *Database) AcquireHostSlot(host, token string, concurrency int, interval, lease time.Duration, now time.Time) (time.Duration, bool, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	wait, err := redis.Int64(acquireHostSlotScript.Do(c, host, token, concurrency,
+		int64(interval/time.Millisecond), int64(lease/time.Millisecond), now.UnixNano()/int64(time.Millisecond)))
+	if err == redis.ErrNil {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(wait) * time.Millisecond, true, nil
+}
+
+// ReleaseHostSlot releases a slot acquired with AcquireHostSlot.
+func (db *Database) ReleaseHostSlot(host, token string) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	_, err := c.Do("ZREM", "crawlslots:"+host, token)
+	return err
+}
+
+// CrawlStats is the information used to schedule crawls of a package.
+type CrawlStats struct {
+	// PopularRank is the rank of the package in the popular packages or -1
+	// if the package does not have a popularity score.
+	PopularRank int
+
+	// Number of packages that import the package.
+	Importers int
+
+	// ChangeRate is the moving average of the fraction of crawls that found
+	// changes or -1 if the package has not been crawled.
+	ChangeRate float64
+
+	// ErrorRate is the moving average of the fraction of crawls that failed
+	// or -1 if the package has not been crawled.
+	ErrorRate float64
+}
+
+var crawlStatsScript = redis.NewScript(0, `
+    local path = ARGV[1]
+    local id = redis.call('HGET', 'ids', path)
+    local rank = false
+    local changeRate = false
+    local errorRate = false
+    if id then
+        rank = redis.call('ZREVRANK', 'popular', id)
+        changeRate = redis.call('HGET', 'pkg:' .. id, 'changerate')
+        errorRate = redis.call('HGET', 'pkg:' .. id, 'errorrate')
+    end
+    return {rank or -1, redis.call('SCARD', 'index:import:' .. path), changeRate or '-1', errorRate or '-1'}
+`)
+
+// CrawlStats returns the information used to schedule crawls of the package
+// with the given import path.
+func (db *Database) CrawlStats(path string) (*CrawlStats, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(crawlStatsScript.Do(c, path))
+	if err != nil {
+		return nil, err
+	}
+	var s CrawlStats
+	if _, err := redis.Scan(values, &s.PopularRank, &s.Importers, &s.ChangeRate, &s.ErrorRate); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+var setCrawlScheduleScript = redis.NewScript(0, `
+    local id = redis.call('HGET', 'ids', ARGV[1])
+    if not id then
+        return
+    end
+    redis.call('HSET', 'pkg:' .. id, 'schedule', ARGV[2])
+    if ARGV[3] ~= '' then
+        redis.call('HSET', 'pkg:' .. id, 'changerate', ARGV[3])
+    end
+    if ARGV[4] ~= '' then
+        redis.call('HSET', 'pkg:' .. id, 'errorrate', ARGV[4])
+    end
+`)
+
+// SetCrawlSchedule records the scheduling decision, change rate and error
+// rate for the package with the given import path. A rate is not updated if
+// it is negative.
+func (db *Database) SetCrawlSchedule(path, schedule string, changeRate, errorRate float64) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	formatRate := func(rate float64) string {
+		if rate < 0 {
+			return ""
+		}
+		return strconv.FormatFloat(rate, 'g', 4, 64)
+	}
+	_, err := setCrawlScheduleScript.Do(c, path, schedule, formatRate(changeRate), formatRate(errorRate))
+	return err
+}
+
+// CrawlError is a record of the consecutive failed crawls of a path.
+type CrawlError struct {
+	// Class is the kind of error: notfound, remote, timeout or error.
+	Class   string
+	Message string
+
+	// Time of the most recent failure.
+	Time time.Time
+
+	// Number of consecutive failures.
+	Attempts int
+
+	// Retry is the time that the path is crawled again.
+	Retry time.Time
+}
+
+var addCrawlErrorScript = redis.NewScript(0, `
+    local path = ARGV[1]
+    local class = ARGV[2]
+    local message = ARGV[3]
+    local now = tonumber(ARGV[4])
+    local minRetry = tonumber(ARGV[5])
+    local maxRetry = tonumber(ARGV[6])
+
+    local key = 'crawlerr:' .. path
+    local attempts = redis.call('HINCRBY', key, 'attempts', 1)
+    local retry = now + math.min(minRetry * math.pow(2, attempts - 1), maxRetry)
+    redis.call('HMSET', key, 'class', class, 'message', message, 'time', now, 'retry', retry)
+
+    local id = redis.call('HGET', 'ids', path)
+    if id then
+        redis.call('ZADD', 'nextCrawl', retry, id)
+    else
+        redis.call('SREM', 'newCrawl', path)
+        redis.call('SADD', 'badCrawl', path)
+    end
+    return {attempts, retry}
+`)
+
+// AddCrawlError records a failed crawl of path at time t and schedules the
+// next attempt. The delay before the next attempt starts at minRetry and
+// doubles with each consecutive failure up to maxRetry.
+func (db *Database) AddCrawlError(path, class, message string, t time.Time, minRetry, maxRetry time.Duration) (*CrawlError, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(addCrawlErrorScript.Do(c, path, class, message, t.Unix(), int64(minRetry/time.Second), int64(maxRetry/time.Second)))
+	if err != nil {
+		return nil, err
+	}
+	e := &CrawlError{Class: class, Message: message, Time: time.Unix(t.Unix(), 0).UTC()}
+	var retry int64
+	if _, err := redis.Scan(values, &e.Attempts, &retry); err != nil {
+		return nil, err
+	}
+	e.Retry = time.Unix(retry, 0).UTC()
+	return e, nil
+}
+
+// ClearCrawlError deletes the crawl error record for path.
+func (db *Database) ClearCrawlError(path string) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	_, err := c.Do("DEL", "crawlerr:"+path)
+	return err
+}
+
+// CrawlStatus is the crawl state of a path.
+type CrawlStatus struct {
+	Path string
+
+	// Exists is true if the path is in the database.
+	Exists bool
+
+	// NextCrawl is the time of the next scheduled crawl of a path in the
+	// database.
+	NextCrawl time.Time
+
+	// Queued is true if the path is in the new crawl queue.
+	Queued bool
+
+	// Schedule describes the scheduling decision for the next crawl.
+	Schedule string
+
+	// Error is the most recent crawl error or nil if the last crawl
+	// succeeded.
+	Error *CrawlError
+}
+
+var crawlStatusScript = redis.NewScript(0, `
+    local path = ARGV[1]
+    local id = redis.call('HGET', 'ids', path)
+    local nextCrawl = false
+    local schedule = false
+    if id then
+        nextCrawl = redis.call('ZSCORE', 'nextCrawl', id)
+        schedule = redis.call('HGET', 'pkg:' .. id, 'schedule')
+    end
+    return {
+        id and 1 or 0,
+        nextCrawl,
+        schedule or '',
+        redis.call('SISMEMBER', 'newCrawl', path),
+        redis.call('HMGET', 'crawlerr:' .. path, 'class', 'message', 'time', 'attempts', 'retry')}
+`)
+
+// CrawlStatus returns the crawl state of path.
+func (db *Database) CrawlStatus(path string) (*CrawlStatus, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(crawlStatusScript.Do(c, path))
+	if err != nil {
+		return nil, err
+	}
+	s := &CrawlStatus{Path: path}
+	var (
+		nextCrawl int64
+		errValues []interface{}
+	)
+	if _, err := redis.Scan(values, &s.Exists, &nextCrawl, &s.Schedule, &s.Queued, &errValues); err != nil {
+		return nil, err
+	}
+	s.NextCrawl = fromUnixTime(nextCrawl)
+	var (
+		e        CrawlError
+		t, retry int64
+	)
+	if _, err := redis.Scan(errValues, &e.Class, &e.Message, &t, &e.Attempts, &retry); err != nil {
+		return nil, err
+	}
+	if e.Attempts > 0 {
+		e.Time = fromUnixTime(t)
+		e.Retry = fromUnixTime(retry)
+		s.Error = &e
+	}
+	return s, nil
+}
+
+var forceCrawlScript = redis.NewScript(0, `
+    local path = ARGV[1]
+    local now = ARGV[2]
+
+    local id = redis.call('HGET', 'ids', path)
+    if id then
+        redis.call('ZADD', 'nextCrawl', now, id)
+    else
+        redis.call('SREM', 'badCrawl', path)
+        redis.call('SADD', 'newCrawl', path)
+    end
+    redis.call('DEL', 'crawlerr:' .. path)
+`)
+
+// ForceCrawl schedules the package with the given import path for crawling
+// before packages that are not overdue. Paths not in the database are added
+// to the new crawl queue even if a previous crawl of the path failed.
+func (db *Database) ForceCrawl(path string) error {
+	c := db.Pool.Get()
+	defer c.Close()
+	_, err := forceCrawlScript.Do(c, path, time.Now().Unix())
+	return err
+}
+
+// CrawlItem is a package in the next crawl queue.
+type CrawlItem struct {
+	Path     string
+	Time     time.Time
+	Schedule string
+}
+
+// CrawlQueues is a summary of the crawl queues.
+type CrawlQueues struct {
+	// Size of the queues.
+	NewCount, BadCount, NextCount int
+
+	// Paths in the newCrawl and badCrawl sets, sorted by path.
+	New, Bad []string
+
+	// Packages that are next in the nextCrawl queue.
+	Next []CrawlItem
+}
+
+var crawlQueuesScript = redis.NewScript(0, `
+    local n = tonumber(ARGV[1])
+    local next = {}
+    local r = redis.call('ZRANGE', 'nextCrawl', 0, n - 1, 'WITHSCORES')
+    for i = 1,#r,2 do
+        local pkg = redis.call('HMGET', 'pkg:' .. r[i], 'path', 'schedule')
+        table.insert(next, pkg[1] or '')
+        table.insert(next, r[i+1])
+        table.insert(next, pkg[2] or '')
+    end
+    return {
+        redis.call('SCARD', 'newCrawl'),
+        redis.call('SCARD', 'badCrawl'),
+        redis.call('ZCARD', 'nextCrawl'),
+        redis.call('SORT', 'newCrawl', 'ALPHA', 'LIMIT', 0, n),
+        redis.call('SORT', 'badCrawl', 'ALPHA', 'LIMIT', 0, n),
+        next}
+`)
+
+// CrawlQueues returns the size of the crawl queues and up to n entries
+// from each queue.
+func (db *Database) CrawlQueues(n int) (*CrawlQueues, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(crawlQueuesScript.Do(c, n))
+	if err != nil {
+		return nil, err
+	}
+	var q CrawlQueues
+	var next []interface{}
+	if _, err := redis.Scan(values, &q.NewCount, &q.BadCount, &q.NextCount, &q.New, &q.Bad, &next); err != nil {
+		return nil, err
+	}
+	for len(next) > 0 {
+		var item CrawlItem
+		var t int64
+		next, err = redis.Scan(next, &item.Path, &t, &item.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		item.Time = time.Unix(t, 0).UTC()
+		q.Next = append(q.Next, item)
+	}
+	return &q, nil
+}
+
+// AuditEntry is a record of an admin action.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"`
+	Path   string    `json:"path"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// maxAudit is the maximum number of audit log entries stored.
+const maxAudit = 10000
+
+// PutAudit adds an entry to the audit log.
+func (db *Database) PutAudit(e *AuditEntry) error {
+	p, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	c := db.Pool.Get()
+	defer c.Close()
+	c.Send("MULTI")
+	c.Send("LPUSH", "audit", p)
+	c.Send("LTRIM", "audit", 0, maxAudit-1)
+	_, err = c.Do("EXEC")
+	return err
+}
+
+// AuditLog returns up to n of the most recent audit log entries, newest
+// first.
+func (db *Database) AuditLog(n int) ([]*AuditEntry, error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(c.Do("LRANGE", "audit", 0, n-1))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*AuditEntry, 0, len(values))
+	for _, v := range values {
+		p, err := redis.Bytes(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(p, &e); err != nil {
+			return nil, err
+		}
+		result = append(result, &e)
+	}
+	return result, nil
+}
+
+// Change is a record of the changes to the exported API of a package between
+// crawls.
+type Change struct {
+	Time    time.Time        `json:"time"`
+	OldEtag string           `json:"oldEtag"`
+	NewEtag string           `json:"newEtag"`
+	Changes []*doc.APIChange `json:"changes"`
+}
+
+// maxChanges is the maximum number of change records stored for a package.
+const maxChanges = 50
+
+var putChangeScript = redis.NewScript(0, `
+    local path = ARGV[1]
+    local change = ARGV[2]
+    local n = ARGV[3]
+
+    local id = redis.call('HGET', 'ids', path)
+    if not id then
+        return false
+    end
+
+    redis.call('LPUSH', 'changes:' .. id, change)
+    redis.call('LTRIM', 'changes:' .. id, 0, n - 1)
+`)
+
+// PutChange adds a change record for the package with the given import path.
+func (db *Database) PutChange(path string, change *Change) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(change); err != nil {
+		return err
+	}
+	c := db.Pool.Get()
+	defer c.Close()
+	_, err := putChangeScript.Do(c, path, buf.Bytes(), maxChanges)
+	return err
+}
+
+var changesScript = redis.NewScript(0, `
+    local path = ARGV[1]
+
+    local id = redis.call('HGET', 'ids', path)
+    if not id then
+        return {}
+    end
+
+    return redis.call('LRANGE', 'changes:' .. id, ARGV[2], ARGV[3])
+`)
+
+// Changes returns the change records for the package with the given import
+// path, newest first.
+func (db *Database) Changes(path string) ([]*Change, error) {
+	changes, _, err := db.changes(path, 0, -1)
+	return changes, err
+}
+
+// ChangesPage returns a page of the change records returned by Changes.
+func (db *Database) ChangesPage(path string, offset, count int) ([]*Change, bool, error) {
+	return db.changes(path, offset, offset+count)
+}
+
+func (db *Database) changes(path string, start, stop int) (changes []*Change, more bool, err error) {
+	c := db.Pool.Get()
+	defer c.Close()
+	values, err := redis.Values(changesScript.Do(c, path, start, stop))
+	if err != nil {
+		return nil, false, err
+	}
+	if stop >= 0 && len(values) > stop-start {
+		values = values[:stop-start]
+		more = true
+	}
+	changes = make([]*Change, 0, len(values))
+	for len(values) > 0 {
+		var p []byte
+		values, err = redis.Scan(values, &p)
+		if err != nil {
+			return nil, false, err
+		}
+		var change Change
+		if err := gob.NewDecoder(bytes.NewReader(p)).Decode(&change); err != nil {
+			return nil, false, err
+		}
+		changes = append(changes, &change)
+	}
+	return changes, more, nil
+}
+
 var incrementCounterScript = redis.NewScript(0, `
     local key = 'counter:' .. ARGV[1]
     local n = tonumber(ARGV[2])
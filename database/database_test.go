@@ -131,10 +131,19 @@ func TestPutGet(t *testing.T) {
 	if err != nil {
 		t.Fatalf("db.Importers() retunred error %v", err)
 	}
-	expectedImporters := []Package{{"github.com/user/repo/foo/bar", "hello"}}
+	expectedImporters := []Package{{Path: "github.com/user/repo/foo/bar", Synopsis: "hello"}}
 	if !reflect.DeepEqual(actualImporters, expectedImporters) {
 		t.Errorf("db.Importers() = %v, want %v", actualImporters, expectedImporters)
 	}
+	for _, count := range []int{1, 2} {
+		page, more, err := db.ImportersPage("github.com/user/repo/foo/bar", 0, count)
+		if err != nil {
+			t.Fatalf("db.ImportersPage() returned error %v", err)
+		}
+		if !reflect.DeepEqual(page, expectedImporters) || more {
+			t.Errorf("db.ImportersPage(0, %d) = %v, %v, want %v, false", count, page, more, expectedImporters)
+		}
+	}
 	actualImports, err := db.Packages(pdoc.Imports)
 	if err != nil {
 		t.Fatalf("db.Imports() retunred error %v", err)
@@ -144,7 +153,7 @@ func TestPutGet(t *testing.T) {
 			actualImports[i].Synopsis = ""
 		}
 	}
-	expectedImports := []Package{{"C", ""}, {"errors", ""}, {"github.com/user/repo/foo/bar", "hello"}}
+	expectedImports := []Package{{Path: "C"}, {Path: "errors"}, {Path: "github.com/user/repo/foo/bar", Synopsis: "hello"}}
 	if !reflect.DeepEqual(actualImports, expectedImports) {
 		t.Errorf("db.Imports() = %v, want %v", actualImports, expectedImports)
 	}
@@ -162,10 +171,19 @@ func TestPutGet(t *testing.T) {
 		t.Errorf("db.Put() returned error %v", err)
 	}
 
-	if err := db.Block("github.com/user/repo"); err != nil {
+	if err := db.Block("github.com/user/repo", "spam", time.Time{}); err != nil {
 		t.Errorf("db.Block() returned error %v", err)
 	}
 
+	if exists, err := db.Exists("github.com/user/repo/foo/bar"); exists || err != nil {
+		t.Errorf("db.Exists(github.com/user/repo/foo/bar) after block returned %v, %v, want false, nil", exists, err)
+	}
+
+	blocks, err := db.ListBlocked()
+	if err != nil || len(blocks) != 1 || blocks[0].Root != "github.com/user/repo" || blocks[0].Reason != "spam" || !blocks[0].Expires.IsZero() {
+		t.Errorf("db.ListBlocked() returned %+v, %v, want github.com/user/repo", blocks, err)
+	}
+
 	blocked, err := db.IsBlocked("github.com/user/repo/foo/bar")
 	if !blocked || err != nil {
 		t.Errorf("db.IsBlocked(github.com/user/repo/foo/bar) returned %v, %v, want true, nil", blocked, err)
@@ -181,6 +199,7 @@ func TestPutGet(t *testing.T) {
 	c.Send("DEL", "maxQueryId")
 	c.Send("DEL", "maxPackageId")
 	c.Send("DEL", "block")
+	c.Send("DEL", "block:github.com/user/repo")
 	c.Send("DEL", "popular:0")
 	c.Send("DEL", "newCrawl")
 	keys, err := redis.Values(c.Do("HKEYS", "ids"))
@@ -193,6 +212,68 @@ func TestPutGet(t *testing.T) {
 	}
 }
 
+func TestImplementations(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	pdocs := []*doc.Package{
+		{
+			ImportPath: "example.com/a",
+			Name:       "a",
+			Types: []*doc.Type{
+				{Name: "File", MethodSet: []string{"Close() error", "Read([]byte) (int, error)"}},
+				{Name: "Pipe", MethodSet: []string{"Close() error"}, PtrMethodSet: []string{"Close() error", "Read([]byte) (int, error)"}},
+				{Name: "Reader", IsInterface: true, MethodSet: []string{"Read([]byte) (int, error)"}},
+			},
+		},
+		{
+			ImportPath: "example.com/b",
+			Name:       "b",
+			Types: []*doc.Type{
+				{Name: "Buffer", MethodSet: []string{"Read([]byte) (int, error)", "Write([]byte) (int, error)"}},
+				{Name: "ReadCloser", IsInterface: true, MethodSet: []string{"Close() error"}, EmbeddedInterfaces: []string{"example.com/a.Reader"}},
+			},
+		},
+	}
+	for _, pdoc := range pdocs {
+		if err := db.Put(pdoc, time.Time{}); err != nil {
+			t.Fatalf("db.Put(%q) returned error %v", pdoc.ImportPath, err)
+		}
+	}
+
+	expected := map[string]map[string]*ImplementationList{
+		"example.com/a": {
+			"File":   {Types: []TypeRef{{"example.com/a", "Reader", false}, {"example.com/b", "ReadCloser", false}}},
+			"Pipe":   {Types: []TypeRef{{"example.com/a", "Reader", true}, {"example.com/b", "ReadCloser", true}}},
+			"Reader": {Types: []TypeRef{{"example.com/a", "File", false}, {"example.com/a", "Pipe", true}, {"example.com/b", "Buffer", false}}},
+		},
+		"example.com/b": {
+			"Buffer":     {Types: []TypeRef{{"example.com/a", "Reader", false}}},
+			"ReadCloser": {Types: []TypeRef{{"example.com/a", "File", false}, {"example.com/a", "Pipe", true}}},
+		},
+	}
+	for path, want := range expected {
+		actual, err := db.Implementations(path)
+		if err != nil {
+			t.Fatalf("db.Implementations(%q) returned error %v", path, err)
+		}
+		if !reflect.DeepEqual(actual, want) {
+			t.Errorf("db.Implementations(%q) = %v, want %v", path, actual, want)
+		}
+	}
+
+	if err := db.Delete("example.com/b"); err != nil {
+		t.Fatalf("db.Delete() returned error %v", err)
+	}
+	actual, err := db.Implementations("example.com/a")
+	if err != nil {
+		t.Fatalf("db.Implementations() returned error %v", err)
+	}
+	if l := actual["Reader"]; l == nil || len(l.Types) != 2 {
+		t.Errorf("after delete, Reader implementations = %v, want File and Pipe", l)
+	}
+}
+
 const epsilon = 0.000001
 
 func TestPopular(t *testing.T) {
@@ -265,3 +346,339 @@ func TestCounter(t *testing.T) {
 		t.Errorf("3: got n=%g, want 2", n)
 	}
 }
+
+func TestAPIKeys(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	created := time.Date(2013, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, k := range []*APIKey{
+		{Key: "b", Name: "ci", Quota: 1000, Created: created},
+		{Key: "a", Name: "ide", Quota: 100, Created: created},
+	} {
+		if err := db.PutAPIKey(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	k, err := db.GetAPIKey("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (&APIKey{Key: "a", Name: "ide", Quota: 100, Created: created}); !reflect.DeepEqual(k, expected) {
+		t.Errorf("GetAPIKey(a) = %+v, want %+v", k, expected)
+	}
+
+	if err := db.DeleteAPIKey("a"); err != nil {
+		t.Fatal(err)
+	}
+	k, err = db.GetAPIKey("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k != nil {
+		t.Errorf("GetAPIKey(a) after delete = %+v, want nil", k)
+	}
+
+	keys, err := db.APIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Key != "b" || keys[0].Quota != 1000 {
+		t.Errorf("APIKeys() = %+v, want key b", keys)
+	}
+}
+
+func TestCrawlQueuesAndAudit(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	for _, path := range []string{"github.com/user/b", "github.com/user/a"} {
+		if err := db.AddNewCrawl(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AddBadCrawl("github.com/user/c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ForceCrawl("github.com/user/c"); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := db.CrawlQueues(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"github.com/user/a", "github.com/user/b", "github.com/user/c"}
+	if q.NewCount != 3 || !reflect.DeepEqual(q.New, expected) {
+		t.Errorf("new crawl queue = %d %v, want 3 %v", q.NewCount, q.New, expected)
+	}
+	if q.BadCount != 0 || len(q.Bad) != 0 {
+		t.Errorf("bad crawl queue = %d %v, want empty", q.BadCount, q.Bad)
+	}
+
+	for _, action := range []string{"block", "unblock"} {
+		if err := db.PutAudit(&AuditEntry{Time: time.Unix(1, 0).UTC(), User: "admin", Action: action, Path: "github.com/user"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := db.AuditLog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != "unblock" || entries[1].Action != "block" {
+		t.Errorf("AuditLog() = %+v, want unblock, block", entries)
+	}
+}
+
+func TestBlockExpires(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	now := time.Now()
+	if err := db.Block("github.com/user/a", "", now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Block("github.com/user/b", "", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]bool{"github.com/user/a/x": false, "github.com/user/b/x": true} {
+		if blocked, err := db.IsBlocked(path); blocked != expected || err != nil {
+			t.Errorf("db.IsBlocked(%s) returned %v, %v, want %v, nil", path, blocked, err, expected)
+		}
+	}
+
+	roots, err := db.ExpireBlocks(now)
+	if err != nil || len(roots) != 1 || roots[0] != "github.com/user/a" {
+		t.Errorf("db.ExpireBlocks() returned %v, %v, want [github.com/user/a]", roots, err)
+	}
+
+	q, err := db.CrawlQueues(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.New) != 1 || q.New[0] != "github.com/user/a" {
+		t.Errorf("new crawl queue after unblock = %v, want [github.com/user/a]", q.New)
+	}
+}
+
+func TestCrawlErrors(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	const path = "github.com/user/repo"
+	now := time.Unix(time.Now().Unix(), 0).UTC()
+	for i, expected := range []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour, 5 * time.Hour} {
+		e, err := db.AddCrawlError(path, "remote", "error", now, time.Hour, 5*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Attempts != i+1 || !e.Retry.Equal(now.Add(expected)) {
+			t.Errorf("attempt %d: got attempts %d, retry %v, want retry %v", i+1, e.Attempts, e.Retry, now.Add(expected))
+		}
+	}
+
+	s, err := db.CrawlStatus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Exists || s.Error == nil || s.Error.Class != "remote" || s.Error.Attempts != 4 {
+		t.Errorf("CrawlStatus() = %+v, want error with 4 attempts", s)
+	}
+
+	// The path is not queued before the retry time.
+	if err := db.AddNewCrawl(path); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := db.CrawlStatus(path); s.Queued {
+		t.Errorf("path queued before retry time")
+	}
+
+	if err := db.ClearCrawlError(path); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := db.CrawlStatus(path); s.Error != nil {
+		t.Errorf("CrawlStatus().Error after clear = %+v, want nil", s.Error)
+	}
+}
+
+func TestDueCrawls(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	now := time.Now().Truncate(time.Second)
+	for i, path := range []string{"github.com/user/a", "github.com/user/b", "example.com/c"} {
+		pdoc := &doc.Package{ImportPath: path, ProjectRoot: path, Name: "p"}
+		if err := db.Put(pdoc, now.Add(time.Duration(i-3)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put(&doc.Package{ImportPath: "example.com/d", ProjectRoot: "example.com/d", Name: "d"}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := db.DueCrawls(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, item := range items {
+		paths = append(paths, item.Path)
+	}
+	expected := []string{"github.com/user/a", "github.com/user/b", "example.com/c"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("DueCrawls() = %v, want %v", paths, expected)
+	}
+
+	// Lease an item behind the head of the queue.
+	leased, err := db.LeaseCrawl(items[2], time.Hour)
+	if err != nil || !leased {
+		t.Fatalf("LeaseCrawl(%v) = %v, %v, want true", items[2], leased, err)
+	}
+	leased, err = db.LeaseCrawl(items[2], time.Hour)
+	if err != nil || leased {
+		t.Errorf("second LeaseCrawl(%v) = %v, %v, want false", items[2], leased, err)
+	}
+	items, err = db.DueCrawls(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Errorf("DueCrawls() after lease = %v, want 2 items", items)
+	}
+}
+
+func TestPackagesPage(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	paths := []string{"github.com/user/c", "github.com/user/a", "github.com/user/b", "github.com/user/d"}
+	for _, path := range paths {
+		pdoc := &doc.Package{ImportPath: path, ProjectRoot: path, Name: "p"}
+		if err := db.Put(pdoc, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("github.com/user/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	after := 0
+	for i := 0; i < 5; i++ {
+		pkgs, next, err := db.PackagesPage(after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pkg := range pkgs {
+			actual = append(actual, pkg.Path)
+		}
+		if next == 0 {
+			break
+		}
+		after = next
+	}
+	expected := []string{"github.com/user/c", "github.com/user/b", "github.com/user/d"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("PackagesPage() = %v, want %v", actual, expected)
+	}
+}
+
+func TestHostSlots(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	now := time.Now()
+	for i, expected := range []time.Duration{0, time.Second} {
+		wait, ok, err := db.AcquireHostSlot("example.com", strconv.Itoa(i), 2, time.Second, time.Hour, now)
+		if err != nil || !ok || wait != expected {
+			t.Errorf("AcquireHostSlot %d = %v, %v, %v, want %v, true", i, wait, ok, err, expected)
+		}
+	}
+	if _, ok, err := db.AcquireHostSlot("example.com", "2", 2, time.Second, time.Hour, now); err != nil || ok {
+		t.Errorf("AcquireHostSlot over concurrency limit = %v, %v, want false", ok, err)
+	}
+	if _, ok, err := db.AcquireHostSlot("example.org", "3", 2, time.Second, time.Hour, now); err != nil || !ok {
+		t.Errorf("AcquireHostSlot for other host = %v, %v, want true", ok, err)
+	}
+	if err := db.ReleaseHostSlot("example.com", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, ok, err := db.AcquireHostSlot("example.com", "4", 2, time.Second, time.Hour, now.Add(5*time.Second)); err != nil || !ok || wait != 0 {
+		t.Errorf("AcquireHostSlot after release = %v, %v, %v, want 0, true", wait, ok, err)
+	}
+
+	// Slots expire with the lease.
+	if _, ok, err := db.AcquireHostSlot("example.com", "5", 2, time.Second, time.Hour, now.Add(2*time.Hour)); err != nil || !ok {
+		t.Errorf("AcquireHostSlot after lease = %v, %v, want true", ok, err)
+	}
+}
+
+func TestCheckLocal(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	if err := db.Put(&doc.Package{ImportPath: "github.com/user/repo", Name: "repo"}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckLocal(false); err != nil {
+		t.Errorf("CheckLocal(false) returned error %v", err)
+	}
+	if err := db.CheckLocal(true); err == nil {
+		t.Errorf("CheckLocal(true) with crawled packages did not return error")
+	}
+	if err := db.Delete("github.com/user/repo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckLocal(true); err != nil {
+		t.Errorf("CheckLocal(true) on empty database returned error %v", err)
+	}
+	if err := db.CheckLocal(false); err == nil {
+		t.Errorf("CheckLocal(false) on local database did not return error")
+	}
+}
+
+func TestCrawlSchedule(t *testing.T) {
+	db := newDB(t)
+	defer closeDB(db)
+
+	pdoc := &doc.Package{ImportPath: "github.com/user/repo", ProjectRoot: "github.com/user/repo", Name: "repo"}
+	if err := db.Put(pdoc, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := db.CrawlStats(pdoc.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ChangeRate != -1 || s.ErrorRate != -1 || s.Importers != 0 {
+		t.Errorf("CrawlStats() = %+v, want rates -1 and no importers", s)
+	}
+
+	if err := db.SetCrawlSchedule(pdoc.ImportPath, "24h0m0s: change rate 0.50", 0.5, 0.2); err != nil {
+		t.Fatal(err)
+	}
+	s, err = db.CrawlStats(pdoc.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ChangeRate != 0.5 || s.ErrorRate != 0.2 {
+		t.Errorf("CrawlStats() = %+v, want change rate 0.5 and error rate 0.2", s)
+	}
+
+	// Storing the package keeps the error rate.
+	if err := db.Put(pdoc, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := db.CrawlStats(pdoc.ImportPath); err != nil || s.ErrorRate != 0.2 {
+		t.Errorf("CrawlStats() after Put = %+v, %v, want error rate 0.2", s, err)
+	}
+	status, err := db.CrawlStatus(pdoc.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Schedule != "24h0m0s: change rate 0.50" {
+		t.Errorf("CrawlStatus().Schedule = %q", status.Schedule)
+	}
+}
@@ -62,6 +62,16 @@ func documentTerms(pdoc *doc.Package, score float64) []string {
 		}
 	}
 
+	// Identifiers used from imported packages
+
+	for _, files := range [][]*doc.File{pdoc.Files, pdoc.TestFiles} {
+		for _, f := range files {
+			for _, use := range f.Uses {
+				terms["use:"+use] = true
+			}
+		}
+	}
+
 	if score > 0 {
 
 		if isStandardPackage(pdoc.ImportPath) {
@@ -139,6 +149,14 @@ func documentScore(pdoc *doc.Package) float64 {
 		r = 1
 	}
 
+	if pdoc.Deprecated != "" {
+		r *= 0.1
+	}
+
+	// Rank well documented packages higher.
+	r *= 0.75 + 0.25*pdoc.Coverage.DocFraction()
+	r *= 1 + 0.1*pdoc.Coverage.ExampleFraction()
+
 	for i := 0; i < strings.Count(pdoc.ImportPath[len(pdoc.ProjectRoot):], "/"); i++ {
 		r *= 0.99
 	}
@@ -81,6 +81,8 @@ var indexTests = []struct {
 		},
 		TestImports: []string{"bytes", "net/url", "testing"},
 		Funcs:       []*doc.Func{{}},
+		Files:       []*doc.File{{Name: "oauth.go", Uses: []string{"net/url.Values", "strings.Join"}}},
+		TestFiles:   []*doc.File{{Name: "oauth_test.go", Uses: []string{"net/url.Values", "testing.T"}}},
 	},
 		[]string{
 			"all:",
@@ -91,6 +93,7 @@ var indexTests = []struct {
 			"import:net/url", "import:regexp", "import:sort", "import:strconv",
 			"import:strings", "import:sync", "import:time", "interfac",
 			"oau", "project:github.com/user/repo", "rfc", "subset",
+			"use:net/url.Values", "use:strings.Join", "use:testing.T",
 		},
 	},
 }
@@ -106,3 +109,12 @@ func TestDocTerms(t *testing.T) {
 		}
 	}
 }
+
+func TestDeprecatedScore(t *testing.T) {
+	pdoc := *indexTests[1].pdoc
+	score := documentScore(&pdoc)
+	pdoc.Deprecated = "Use github.com/user/repo/dir2."
+	if deprecatedScore := documentScore(&pdoc); deprecatedScore >= score {
+		t.Errorf("documentScore(deprecated) = %g, want less than %g", deprecatedScore, score)
+	}
+}
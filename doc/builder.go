@@ -23,8 +23,10 @@ import (
 	"go/format"
 	"go/parser"
 	"go/token"
+	"path"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -112,6 +114,19 @@ Loop:
 	return s
 }
 
+var deprecatedPat = regexp.MustCompile(`(?:^|\n\n)Deprecated: ((?:[^\n]|\n[^\n])+)`)
+
+// deprecated returns the text of the "Deprecated: " paragraph in the doc
+// comment s or "" if there is no such paragraph. All runs of whitespace are
+// replaced by a single space.
+func deprecated(s string) string {
+	m := deprecatedPat.FindStringSubmatch(s)
+	if m == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(m[1]), " ")
+}
+
 var referencesPats = []*regexp.Regexp{
 	regexp.MustCompile(`"([-a-zA-Z0-9~+_./]+)"`), // quoted path
 	regexp.MustCompile(`https://drone\.io/([-a-zA-Z0-9~+_./]+)/status\.png`),
@@ -137,6 +152,52 @@ func addReferences(references map[string]bool, s []byte) {
 	}
 }
 
+// Readme is a README file found in the package directory.
+type Readme struct {
+	// File name. The extension determines the format: Markdown,
+	// reStructuredText or plain text.
+	Name string
+
+	// URL of the file in the VCS source browser. Relative links in the
+	// README are resolved against this URL.
+	URL string
+
+	Text string
+}
+
+var readmePat = regexp.MustCompile(`(?i)^readme(?:\.(?:md|markdown|mdown|rst|txt|text))?$`)
+
+// maxReadmeSize is the maximum size of a README stored in a package.
+const maxReadmeSize = 64 * 1024
+
+// readmeRank returns the preference for README file name. Files with higher
+// rank are preferred.
+func readmeRank(name string) int {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown", ".mdown":
+		return 3
+	case ".rst":
+		return 2
+	case ".txt", ".text":
+		return 1
+	}
+	return 0
+}
+
+func newReadme(file *gosrc.File) *Readme {
+	if !readmePat.MatchString(file.Name) || !utf8.Valid(file.Data) {
+		return nil
+	}
+	text := file.Data
+	if len(text) > maxReadmeSize {
+		text = text[:maxReadmeSize]
+		if i := bytes.LastIndex(text, []byte("\n\n")); i > 0 {
+			text = text[:i]
+		}
+	}
+	return &Readme{Name: file.Name, URL: file.BrowseURL, Text: string(text)}
+}
+
 type byFuncName []*doc.Func
 
 func (s byFuncName) Len() int           { return len(s) }
@@ -156,27 +217,63 @@ type builder struct {
 	srcs     map[string]*source
 	fset     *token.FileSet
 	examples []*doc.Example
-	buf      []byte // scratch space for printNode method.
+	consts   map[*ast.Ident]string // evaluated constants
+	buf      []byte                // scratch space for printNode method.
 }
 
 type Value struct {
-	Decl Code
-	Pos  Pos
-	Doc  string
+	Decl       Code
+	Pos        Pos
+	Doc        string
+	Deprecated string
+
+	// Exported names declared by the value, in declaration order.
+	Names []string
+
+	// Evaluated values of constants declared with expressions.
+	Values []*ConstValue
 }
 
 func (b *builder) values(vdocs []*doc.Value) []*Value {
 	var result []*Value
 	for _, d := range vdocs {
 		result = append(result, &Value{
-			Decl: b.printDecl(d.Decl),
-			Pos:  b.position(d.Decl),
-			Doc:  d.Doc,
+			Decl:       b.printDecl(d.Decl),
+			Pos:        b.position(d.Decl),
+			Doc:        d.Doc,
+			Deprecated: deprecated(d.Doc),
+			Names:      exportedValueNames(d.Names),
+			Values:     b.constValues(d.Decl),
 		})
 	}
 	return result
 }
 
+func exportedValueNames(names []string) []string {
+	var result []string
+	for _, name := range names {
+		if ast.IsExported(name) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func (b *builder) constValues(decl *ast.GenDecl) []*ConstValue {
+	if decl.Tok != token.CONST {
+		return nil
+	}
+	var result []*ConstValue
+	for _, spec := range decl.Specs {
+		for _, name := range spec.(*ast.ValueSpec).Names {
+			if v, ok := b.consts[name]; ok && name.Name != "_" {
+				result = append(result, &ConstValue{Name: name.Name, Value: v})
+			}
+		}
+	}
+	return result
+}
+
 type Note struct {
 	Pos  Pos
 	UID  string
@@ -258,12 +355,13 @@ func (b *builder) getExamples(name string) []*Example {
 }
 
 type Func struct {
-	Decl     Code
-	Pos      Pos
-	Doc      string
-	Name     string
-	Recv     string
-	Examples []*Example
+	Decl       Code
+	Pos        Pos
+	Doc        string
+	Deprecated string
+	Name       string
+	Recv       string
+	Examples   []*Example
 }
 
 func (b *builder) funcs(fdocs []*doc.Func) []*Func {
@@ -279,42 +377,137 @@ func (b *builder) funcs(fdocs []*doc.Func) []*Func {
 			exampleName = d.Recv + "_" + d.Name
 		}
 		result = append(result, &Func{
-			Decl:     b.printDecl(d.Decl),
-			Pos:      b.position(d.Decl),
-			Doc:      d.Doc,
-			Name:     d.Name,
-			Recv:     d.Recv,
-			Examples: b.getExamples(exampleName),
+			Decl:       b.printDecl(d.Decl),
+			Pos:        b.position(d.Decl),
+			Doc:        d.Doc,
+			Deprecated: deprecated(d.Doc),
+			Name:       d.Name,
+			Recv:       d.Recv,
+			Examples:   b.getExamples(exampleName),
 		})
 	}
 	return result
 }
 
 type Type struct {
-	Doc      string
-	Name     string
-	Decl     Code
-	Pos      Pos
-	Consts   []*Value
-	Vars     []*Value
-	Funcs    []*Func
-	Methods  []*Func
-	Examples []*Example
+	Doc        string
+	Deprecated string
+	Name       string
+	Decl       Code
+	Pos        Pos
+	Consts     []*Value
+	Vars       []*Value
+	Funcs      []*Func
+	Methods    []*Func
+	Examples   []*Example
+
+	// Exported fields of a struct type or methods of an interface type.
+	Fields []*Field
+
+	IsInterface bool
+
+	// Sorted method signatures with types qualified by import path. For
+	// interfaces, MethodSet is nil if the method set cannot be determined
+	// and EmbeddedInterfaces lists the interfaces from other packages
+	// embedded in the interface. For other types, MethodSet is the method
+	// set of T and PtrMethodSet is the method set of *T if *T has methods
+	// that T does not.
+	MethodSet          []string
+	PtrMethodSet       []string
+	EmbeddedInterfaces []string
+}
+
+// Field is a struct field or an interface method.
+type Field struct {
+	// Name of the field or method. The name of an embedded field is the
+	// name of the type.
+	Name       string
+	Type       Code
+	Tag        string
+	Doc        string
+	Deprecated string
+	Embedded   bool
+	Pos        Pos
+}
+
+// embeddedName returns the field name for an embedded type.
+func embeddedName(x ast.Expr) string {
+	switch x := x.(type) {
+	case *ast.StarExpr:
+		return embeddedName(x.X)
+	case *ast.SelectorExpr:
+		return x.Sel.Name
+	case *ast.Ident:
+		return x.Name
+	}
+	return ""
+}
+
+// fields returns the fields or methods in a type declaration.
+func (b *builder) fields(decl *ast.GenDecl) []*Field {
+	var result []*Field
+	for _, spec := range decl.Specs {
+		ts, ok := spec.(*ast.TypeSpec)
+		if !ok {
+			continue
+		}
+		var list *ast.FieldList
+		switch t := ts.Type.(type) {
+		case *ast.StructType:
+			list = t.Fields
+		case *ast.InterfaceType:
+			list = t.Methods
+		}
+		if list == nil {
+			continue
+		}
+		for _, f := range list.List {
+			doc := f.Doc.Text()
+			if doc == "" {
+				doc = f.Comment.Text()
+			}
+			var tag string
+			if f.Tag != nil {
+				tag, _ = strconv.Unquote(f.Tag.Value)
+			}
+			field := &Field{
+				Type:       b.printNode(f.Type),
+				Tag:        tag,
+				Doc:        doc,
+				Deprecated: deprecated(doc),
+				Pos:        b.position(f),
+			}
+			if len(f.Names) == 0 {
+				field.Name = embeddedName(f.Type)
+				field.Embedded = true
+				result = append(result, field)
+				continue
+			}
+			for _, name := range f.Names {
+				named := *field
+				named.Name = name.Name
+				result = append(result, &named)
+			}
+		}
+	}
+	return result
 }
 
 func (b *builder) types(tdocs []*doc.Type) []*Type {
 	var result []*Type
 	for _, d := range tdocs {
 		result = append(result, &Type{
-			Doc:      d.Doc,
-			Name:     d.Name,
-			Decl:     b.printDecl(d.Decl),
-			Pos:      b.position(d.Decl),
-			Consts:   b.values(d.Consts),
-			Vars:     b.values(d.Vars),
-			Funcs:    b.funcs(d.Funcs),
-			Methods:  b.funcs(d.Methods),
-			Examples: b.getExamples(d.Name),
+			Doc:        d.Doc,
+			Deprecated: deprecated(d.Doc),
+			Name:       d.Name,
+			Decl:       b.printDecl(d.Decl),
+			Pos:        b.position(d.Decl),
+			Consts:     b.values(d.Consts),
+			Vars:       b.values(d.Vars),
+			Funcs:      b.funcs(d.Funcs),
+			Methods:    b.funcs(d.Methods),
+			Examples:   b.getExamples(d.Name),
+			Fields:     b.fields(d.Decl),
 		})
 	}
 	return result
@@ -336,6 +529,17 @@ var packageNamePats = []*regexp.Regexp{
 	regexp.MustCompile(`([^/]+)$`),
 }
 
+// GuessPackageName returns the package name for an import path. The empty
+// string is returned if the name cannot be guessed.
+func GuessPackageName(path string) string {
+	for _, pat := range packageNamePats {
+		if m := pat.FindStringSubmatch(path); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
 func simpleImporter(imports map[string]*ast.Object, path string) (*ast.Object, error) {
 	pkg := imports[path]
 	if pkg != nil {
@@ -343,22 +547,26 @@ func simpleImporter(imports map[string]*ast.Object, path string) (*ast.Object, e
 	}
 
 	// Guess the package name without importing it.
-	for _, pat := range packageNamePats {
-		m := pat.FindStringSubmatch(path)
-		if m != nil {
-			pkg = ast.NewObj(ast.Pkg, m[1])
-			pkg.Data = ast.NewScope(nil)
-			imports[path] = pkg
-			return pkg, nil
-		}
+	name := GuessPackageName(path)
+	if name == "" {
+		return nil, errors.New("package not found")
 	}
-
-	return nil, errors.New("package not found")
+	pkg = ast.NewObj(ast.Pkg, name)
+	pkg.Data = ast.NewScope(nil)
+	imports[path] = pkg
+	return pkg, nil
 }
 
 type File struct {
 	Name string
 	URL  string
+
+	// Hash of the file contents.
+	Hash string
+
+	// Exported identifiers referenced from imported packages in the form
+	// "import/path.Name".
+	Uses []string
 }
 
 type Pos struct {
@@ -375,7 +583,7 @@ type source struct {
 }
 
 // PackageVersion is modified when previously stored packages are invalid.
-const PackageVersion = "6"
+const PackageVersion = "19"
 
 type Package struct {
 	// The import path for this package.
@@ -393,9 +601,15 @@ type Package struct {
 	// Errors found when fetching or parsing this package.
 	Errors []string
 
+	// Problems found by the lint checks.
+	Lint []*LintMessage
+
 	// Packages referenced in README files.
 	References []string
 
+	// README file in the directory or nil if there is no README.
+	Readme *Readme
+
 	// Version control system: git, hg, bzr, ...
 	VCS string
 
@@ -417,6 +631,9 @@ type Package struct {
 	Synopsis string
 	Doc      string
 
+	// Text of the "Deprecated: " paragraph in the package documentation.
+	Deprecated string
+
 	// Format this package as a command.
 	IsCmd bool
 
@@ -435,6 +652,12 @@ type Package struct {
 	// Package examples
 	Examples []*Example
 
+	// Documentation coverage of the exported API.
+	Coverage Coverage
+
+	// Command-line flags declared by a command.
+	Flags []*Flag
+
 	Notes map[string][]*Note
 	Bugs  []string
 
@@ -444,6 +667,11 @@ type Package struct {
 	Files     []*File
 	TestFiles []*File
 
+	// Contents of Files and TestFiles by hash. Source is not stored with the
+	// documentation. Source is nil when the package is loaded from the
+	// database.
+	Source map[string][]byte
+
 	// Source size in bytes.
 	SourceSize     int
 	TestSourceSize int
@@ -460,6 +688,14 @@ var goEnvs = []struct{ GOOS, GOARCH string }{
 	{"windows", "amd64"},
 }
 
+// addSource records the contents of a source file and returns the hash of
+// the contents.
+func (pkg *Package) addSource(data []byte) string {
+	hash := sourceHash(data)
+	pkg.Source[hash] = data
+	return hash
+}
+
 func newPackage(dir *gosrc.Directory) (*Package, error) {
 
 	pkg := &Package{
@@ -473,6 +709,7 @@ func newPackage(dir *gosrc.Directory) (*Package, error) {
 		Etag:           PackageVersion + "-" + dir.Etag,
 		VCS:            dir.VCS,
 		Subdirectories: dir.Subdirectories,
+		Source:         make(map[string][]byte),
 	}
 
 	var b builder
@@ -484,6 +721,9 @@ func newPackage(dir *gosrc.Directory) (*Package, error) {
 			b.srcs[file.Name] = &source{name: file.Name, browseURL: file.BrowseURL, data: file.Data}
 		} else {
 			addReferences(references, file.Data)
+			if r := newReadme(file); r != nil && (pkg.Readme == nil || readmeRank(r.Name) > readmeRank(pkg.Readme.Name)) {
+				pkg.Readme = r
+			}
 		}
 	}
 
@@ -533,15 +773,16 @@ func newPackage(dir *gosrc.Directory) (*Package, error) {
 	sort.Strings(names)
 	pkg.Files = make([]*File, len(names))
 	for i, name := range names {
-		file, err := parser.ParseFile(b.fset, name, b.srcs[name].data, parser.ParseComments)
+		src := b.srcs[name]
+		src.index = i
+		pkg.Files[i] = &File{Name: name, URL: src.browseURL, Hash: pkg.addSource(src.data)}
+		file, err := parser.ParseFile(b.fset, name, src.data, parser.ParseComments)
 		if err != nil {
 			pkg.Errors = append(pkg.Errors, err.Error())
 		} else {
 			files[name] = file
+			pkg.Files[i].Uses = fileUses(file)
 		}
-		src := b.srcs[name]
-		src.index = i
-		pkg.Files[i] = &File{Name: name, URL: src.browseURL}
 		pkg.SourceSize += len(src.data)
 	}
 
@@ -553,17 +794,25 @@ func newPackage(dir *gosrc.Directory) (*Package, error) {
 	sort.Strings(names)
 	pkg.TestFiles = make([]*File, len(names))
 	for i, name := range names {
+		pkg.TestFiles[i] = &File{Name: name, URL: b.srcs[name].browseURL, Hash: pkg.addSource(b.srcs[name].data)}
 		file, err := parser.ParseFile(b.fset, name, b.srcs[name].data, parser.ParseComments)
 		if err != nil {
 			pkg.Errors = append(pkg.Errors, err.Error())
 		} else {
 			b.examples = append(b.examples, doc.Examples(file)...)
+			pkg.TestFiles[i].Uses = fileUses(file)
 		}
-		pkg.TestFiles[i] = &File{Name: name, URL: b.srcs[name].browseURL}
 		pkg.TestSourceSize += len(b.srcs[name].data)
 	}
 
-	b.vetPackage(pkg, apkg)
+	l := b.newLinter(pkg)
+	l.checkFiles(apkg)
+
+	if bpkg.IsCommand() {
+		pkg.Flags = b.flags(apkg)
+	}
+
+	b.consts = evalConstants(apkg)
 
 	mode := doc.Mode(0)
 	if pkg.ImportPath == "builtin" {
@@ -579,6 +828,7 @@ func newPackage(dir *gosrc.Directory) (*Package, error) {
 	pkg.Name = dpkg.Name
 	pkg.Doc = strings.TrimRight(dpkg.Doc, " \t\n\r")
 	pkg.Synopsis = synopsis(pkg.Doc)
+	pkg.Deprecated = deprecated(pkg.Doc)
 
 	pkg.Examples = b.getExamples("")
 	pkg.IsCmd = bpkg.IsCommand()
@@ -588,9 +838,19 @@ func newPackage(dir *gosrc.Directory) (*Package, error) {
 	pkg.Consts = b.values(dpkg.Consts)
 	pkg.Funcs = b.funcs(dpkg.Funcs)
 	pkg.Types = b.types(dpkg.Types)
+	if !pkg.IsCmd {
+		methodSets(pkg.ImportPath, pkg.Types, dpkg.Types)
+	}
 	pkg.Vars = b.values(dpkg.Vars)
 	pkg.Notes = b.notes(dpkg.Notes)
 
+	if !pkg.IsCmd {
+		pkg.Coverage = coverage(pkg, dpkg)
+	}
+
+	l.checkPackage(dpkg)
+	pkg.Lint = l.messages
+
 	pkg.Imports = bpkg.Imports
 	pkg.TestImports = bpkg.TestImports
 	pkg.XTestImports = bpkg.XTestImports
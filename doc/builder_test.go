@@ -16,6 +16,10 @@ package doc
 
 import (
 	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"reflect"
 	"testing"
 )
 
@@ -99,3 +103,145 @@ func TestSimpleImporter(t *testing.T) {
 		}
 	}
 }
+
+var deprecatedTests = []struct {
+	doc, notice string
+}{
+	{"Package foo does things.\n", ""},
+	{"Deprecated: Use bar.\n", "Use bar."},
+	{"F does things.\n\nDeprecated: Use G\ninstead.\n\nMore text.\n", "Use G instead."},
+	{"F does things.\nDeprecated: not a paragraph.\n", ""},
+}
+
+func TestDeprecated(t *testing.T) {
+	for _, tt := range deprecatedTests {
+		if notice := deprecated(tt.doc); notice != tt.notice {
+			t.Errorf("deprecated(%q) = %q, want %q", tt.doc, notice, tt.notice)
+		}
+	}
+}
+
+const fieldsSource = `package foo
+
+import "io"
+
+type T struct {
+	// A is documented.
+	A, B int ` + "`json:\"a\"`" + `
+	C    string // Deprecated: Use A.
+	io.Reader
+	hidden int
+}
+
+type I interface {
+	// M is a method.
+	M() error
+}
+`
+
+func TestFields(t *testing.T) {
+	pdoc := buildTestPackage(t, fieldsSource)
+	type field struct {
+		Name, Type, Tag, Doc, Deprecated string
+		Embedded                         bool
+	}
+	var actual []field
+	for _, typ := range pdoc.Types {
+		for _, f := range typ.Fields {
+			actual = append(actual, field{typ.Name + "." + f.Name, f.Type.Text, f.Tag, f.Doc, f.Deprecated, f.Embedded})
+		}
+	}
+	expected := []field{
+		{"I.M", "func() error", "", "M is a method.\n", "", false},
+		{"T.A", "int", `json:"a"`, "A is documented.\n", "", false},
+		{"T.B", "int", `json:"a"`, "A is documented.\n", "", false},
+		{"T.C", "string", "", "Deprecated: Use A.\n", "Use A.", false},
+		{"T.Reader", "io.Reader", "", "", "", true},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("fields = %+v, want %+v", actual, expected)
+	}
+}
+
+const valueNamesSource = `package foo
+
+const (
+	A = iota
+	b
+	C
+)
+
+var X, y int
+`
+
+func TestValueNames(t *testing.T) {
+	pdoc := buildTestPackage(t, valueNamesSource)
+	var actual [][]string
+	for _, v := range append(pdoc.Consts, pdoc.Vars...) {
+		actual = append(actual, v.Names)
+	}
+	expected := [][]string{{"A", "C"}, {"X"}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("names = %v, want %v", actual, expected)
+	}
+}
+
+const methodSetsSource = `package foo
+
+import "io"
+
+type I interface {
+	io.Closer
+	J
+	M(p []byte, n int) (int, error)
+}
+
+type J interface {
+	N(f func(string) bool, x ...interface{}) map[string]*T
+}
+
+type K interface {
+	m()
+}
+
+type T struct{}
+
+func (T) M(q []byte, m int) (n int, err error) { return 0, nil }
+func (*T) N(func(string) bool, ...interface{}) map[string]*T { return nil }
+func (*T) unexported() {}
+`
+
+func TestMethodSets(t *testing.T) {
+	b := &builder{fset: token.NewFileSet(), srcs: make(map[string]*source)}
+	file, err := parser.ParseFile(b.fset, "foo.go", methodSetsSource, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apkg, _ := ast.NewPackage(b.fset, map[string]*ast.File{"foo.go": file}, simpleImporter, nil)
+	dpkg := doc.New(apkg, "example.com/foo", 0)
+	types := b.types(dpkg.Types)
+	methodSets("example.com/foo", types, dpkg.Types)
+
+	type methodSet struct {
+		Name         string
+		IsInterface  bool
+		MethodSet    []string
+		PtrMethodSet []string
+		Embedded     []string
+	}
+	var actual []methodSet
+	for _, typ := range types {
+		actual = append(actual, methodSet{typ.Name, typ.IsInterface, typ.MethodSet, typ.PtrMethodSet, typ.EmbeddedInterfaces})
+	}
+	m := "M([]byte, int) (int, error)"
+	n := "N(func(string) bool, ...interface{}) map[string]*example.com/foo.T"
+	expected := []methodSet{
+		{"I", true, []string{m, n}, nil, []string{"io.Closer"}},
+		{"J", true, []string{n}, nil, nil},
+		{"K", true, nil, nil, nil},
+		{"T", false, []string{m}, []string{m, n}, nil},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("methodSets() = %+v, want %+v", actual, expected)
+	}
+}
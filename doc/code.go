@@ -85,7 +85,8 @@ const (
 	LinkAnnotation AnnotationKind = iota
 
 	// Anchor with name specified by Text[Pos:End] or typeName + "." +
-	// Text[Pos:End] for type declarations.
+	// Text[Pos:End] for type declarations. If PathIndex >= 0, then typeName
+	// is Paths[PathIndex].
 	AnchorAnnotation
 
 	// Comment.
@@ -215,11 +216,15 @@ func (v *annotationVisitor) Visit(n ast.Node) ast.Visitor {
 	return nil
 }
 
-func (b *builder) printDecl(decl ast.Decl) (d Code) {
+func (b *builder) printDecl(decl ast.Decl) Code {
+	return b.printNode(decl)
+}
+
+func (b *builder) printNode(node ast.Node) (d Code) {
 	v := &annotationVisitor{pathIndex: make(map[string]int)}
-	ast.Walk(v, decl)
+	ast.Walk(v, node)
 	b.buf = b.buf[:0]
-	err := (&printer.Config{Mode: printer.UseSpaces, Tabwidth: 4}).Fprint(sliceWriter{&b.buf}, b.fset, decl)
+	err := (&printer.Config{Mode: printer.UseSpaces, Tabwidth: 4}).Fprint(sliceWriter{&b.buf}, b.fset, node)
 	if err != nil {
 		return Code{Text: err.Error()}
 	}
@@ -0,0 +1,325 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+)
+
+// ConstValue is the evaluated value of a named constant.
+type ConstValue struct {
+	Name  string
+	Value string
+}
+
+// constSpec is a constant specification with implicit repetition of the
+// previous expression list resolved.
+type constSpec struct {
+	typ    ast.Expr
+	values []ast.Expr
+	iota   int
+}
+
+// constEvaluator evaluates the constants declared in a package. References
+// to constants in other packages are not resolved.
+type constEvaluator struct {
+	specs  map[*ast.ValueSpec]constSpec
+	values map[*ast.Object]constant.Value
+	busy   map[*ast.Object]bool
+}
+
+// unsignedBits maps the predeclared unsigned integer types to their size.
+var unsignedBits = map[string]int{
+	"uint": 64, "uint8": 8, "uint16": 16, "uint32": 32, "uint64": 64, "uintptr": 64, "byte": 8,
+}
+
+// basicType returns the name of the predeclared type underlying the type
+// expression x. Named types declared in the package are resolved to their
+// underlying type. The result is false if the underlying type is not a
+// predeclared type or cannot be determined.
+func basicType(x ast.Expr) (string, bool) {
+	for i := 0; i < 10; i++ {
+		switch y := x.(type) {
+		case *ast.ParenExpr:
+			x = y.X
+			continue
+		case *ast.Ident:
+			if y.Obj == nil && predeclared[y.Name] == predeclaredType {
+				return y.Name, true
+			}
+			if y.Obj != nil && y.Obj.Kind == ast.Typ {
+				if spec, ok := y.Obj.Decl.(*ast.TypeSpec); ok {
+					x = spec.Type
+					continue
+				}
+			}
+		}
+		break
+	}
+	return "", false
+}
+
+// convert converts v to the predeclared type with the given name.
+func convert(v constant.Value, typ string) constant.Value {
+	switch typ {
+	case "", "bool":
+		return v
+	case "string":
+		if v.Kind() == constant.Int {
+			if n, ok := constant.Int64Val(v); ok {
+				return constant.MakeString(string(rune(n)))
+			}
+			return constant.MakeUnknown()
+		}
+		return v
+	case "float32", "float64":
+		return constant.ToFloat(v)
+	case "complex64", "complex128":
+		return constant.ToComplex(v)
+	default:
+		return constant.ToInt(v)
+	}
+}
+
+// exprType returns the predeclared type underlying the type of the constant
+// expression x or "" if x is untyped. The result is false if x is typed and
+// the type cannot be determined.
+func (e *constEvaluator) exprType(x ast.Expr) (string, bool) {
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return e.exprType(x.X)
+	case *ast.UnaryExpr:
+		return e.exprType(x.X)
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return "", true
+		case token.SHL, token.SHR:
+			return e.exprType(x.X)
+		}
+		if t, ok := e.exprType(x.X); t != "" || !ok {
+			return t, ok
+		}
+		return e.exprType(x.Y)
+	case *ast.CallExpr:
+		if id, ok := x.Fun.(*ast.Ident); ok && id.Obj == nil && id.Name == "len" {
+			return "", true
+		}
+		if len(x.Args) == 1 {
+			return basicType(x.Fun)
+		}
+	case *ast.Ident:
+		if x.Obj == nil || x.Obj.Kind != ast.Con {
+			break
+		}
+		spec, ok := x.Obj.Decl.(*ast.ValueSpec)
+		if !ok || e.busy[x.Obj] {
+			return "", false
+		}
+		cs := e.specs[spec]
+		if cs.typ != nil {
+			return basicType(cs.typ)
+		}
+		// The type of an untyped declaration is the type of its value.
+		for i, name := range spec.Names {
+			if name.Obj == x.Obj && i < len(cs.values) {
+				e.busy[x.Obj] = true
+				typ, ok := e.exprType(cs.values[i])
+				delete(e.busy, x.Obj)
+				return typ, ok
+			}
+		}
+	}
+	return "", true
+}
+
+func (e *constEvaluator) eval(x ast.Expr, iota int) constant.Value {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(x.Value, x.Kind, 0)
+	case *ast.Ident:
+		if x.Obj == nil {
+			switch x.Name {
+			case "iota":
+				return constant.MakeInt64(int64(iota))
+			case "true":
+				return constant.MakeBool(true)
+			case "false":
+				return constant.MakeBool(false)
+			}
+		} else if x.Obj.Kind == ast.Con {
+			return e.value(x.Obj)
+		}
+	case *ast.ParenExpr:
+		return e.eval(x.X, iota)
+	case *ast.UnaryExpr:
+		v := e.eval(x.X, iota)
+		if v.Kind() == constant.Unknown {
+			return v
+		}
+		typ, ok := e.exprType(x.X)
+		if !ok {
+			return constant.MakeUnknown()
+		}
+		return constant.UnaryOp(x.Op, v, uint(unsignedBits[typ]))
+	case *ast.BinaryExpr:
+		a := e.eval(x.X, iota)
+		b := e.eval(x.Y, iota)
+		if a.Kind() == constant.Unknown || b.Kind() == constant.Unknown {
+			return constant.MakeUnknown()
+		}
+		switch x.Op {
+		case token.SHL, token.SHR:
+			s, ok := constant.Uint64Val(constant.ToInt(b))
+			if !ok || s > 1024 {
+				return constant.MakeUnknown()
+			}
+			return constant.Shift(constant.ToInt(a), x.Op, uint(s))
+		}
+		if (a.Kind() == constant.String) != (b.Kind() == constant.String) ||
+			(a.Kind() == constant.Bool) != (b.Kind() == constant.Bool) {
+			return constant.MakeUnknown()
+		}
+		switch x.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return constant.MakeBool(constant.Compare(a, x.Op, b))
+		case token.QUO, token.REM:
+			if constant.Sign(b) == 0 {
+				return constant.MakeUnknown()
+			}
+			if x.Op == token.QUO && a.Kind() == constant.Int && b.Kind() == constant.Int {
+				return constant.BinaryOp(a, token.QUO_ASSIGN, b)
+			}
+		}
+		return constant.BinaryOp(a, x.Op, b)
+	case *ast.CallExpr:
+		if len(x.Args) != 1 {
+			break
+		}
+		if id, ok := x.Fun.(*ast.Ident); ok && id.Obj == nil && id.Name == "len" {
+			v := e.eval(x.Args[0], iota)
+			if v.Kind() == constant.String {
+				return constant.MakeInt64(int64(len(constant.StringVal(v))))
+			}
+			break
+		}
+		// Conversions to types in other packages are not resolved.
+		if typ, ok := basicType(x.Fun); ok {
+			return convert(e.eval(x.Args[0], iota), typ)
+		}
+	}
+	return constant.MakeUnknown()
+}
+
+// value returns the value of the constant obj.
+func (e *constEvaluator) value(obj *ast.Object) constant.Value {
+	if v, ok := e.values[obj]; ok {
+		return v
+	}
+	spec, ok := obj.Decl.(*ast.ValueSpec)
+	if !ok || e.busy[obj] {
+		return constant.MakeUnknown()
+	}
+	e.busy[obj] = true
+	v := constant.MakeUnknown()
+	cs := e.specs[spec]
+	for i, name := range spec.Names {
+		if name.Obj == obj && i < len(cs.values) {
+			v = e.eval(cs.values[i], cs.iota)
+			if cs.typ != nil && v.Kind() != constant.Unknown {
+				if typ, ok := basicType(cs.typ); ok {
+					v = convert(v, typ)
+				} else {
+					v = constant.MakeUnknown()
+				}
+			}
+		}
+	}
+	delete(e.busy, obj)
+	e.values[obj] = v
+	return v
+}
+
+// safeValue returns the value of the constant obj. The go/constant package
+// panics on operations with mismatched operands. The value is unknown when
+// that happens.
+func (e *constEvaluator) safeValue(obj *ast.Object) (v constant.Value) {
+	defer func() {
+		if r := recover(); r != nil {
+			v = constant.MakeUnknown()
+			e.busy = make(map[*ast.Object]bool)
+		}
+	}()
+	return e.value(obj)
+}
+
+// constString returns the string representation of v or "" if the value is
+// unknown.
+func constString(v constant.Value) string {
+	switch v.Kind() {
+	case constant.Unknown:
+		return ""
+	case constant.Int:
+		return v.ExactString()
+	default:
+		return v.String()
+	}
+}
+
+// evalConstants returns the values of the constants in the package keyed by
+// the identifier in the declaration. Constants declared with a literal
+// value and constants with values that cannot be determined are omitted.
+func evalConstants(apkg *ast.Package) map[*ast.Ident]string {
+	e := &constEvaluator{
+		specs:  make(map[*ast.ValueSpec]constSpec),
+		values: make(map[*ast.Object]constant.Value),
+		busy:   make(map[*ast.Object]bool),
+	}
+	for _, file := range apkg.Files {
+		for _, decl := range file.Decls {
+			d, ok := decl.(*ast.GenDecl)
+			if !ok || d.Tok != token.CONST {
+				continue
+			}
+			var last constSpec
+			for i, spec := range d.Specs {
+				spec := spec.(*ast.ValueSpec)
+				if len(spec.Values) > 0 {
+					last = constSpec{typ: spec.Type, values: spec.Values}
+				}
+				last.iota = i
+				e.specs[spec] = last
+			}
+		}
+	}
+
+	values := make(map[*ast.Ident]string)
+	for spec, cs := range e.specs {
+		for i, name := range spec.Names {
+			if name.Obj == nil || name.Name == "_" || i >= len(cs.values) {
+				continue
+			}
+			if _, ok := cs.values[i].(*ast.BasicLit); ok && len(spec.Values) > 0 {
+				continue
+			}
+			if s := constString(e.safeValue(name.Obj)); s != "" {
+				values[name] = s
+			}
+		}
+	}
+	return values
+}
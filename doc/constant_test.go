@@ -0,0 +1,106 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+const constSource = `package foo
+
+import "time"
+
+type Weekday int
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+)
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+)
+
+const (
+	A = 1
+	B = A + 2
+	C = "a" + "b"
+	D = len(C)
+	E = 7 / 2
+	F = 7 / 2.0
+	G = ^uint8(0)
+	H = Tuesday > Monday
+	I = time.Second * 2
+	J = 1 / 0
+	K = "a" + 1
+)
+
+const L, M = iota * 10, -iota
+
+type Mode uint8
+
+type Perm Mode
+
+const (
+	All  Mode = ^Mode(0)
+	Read      = All &^ 1
+	Inv       = ^(Read | 2)
+	Mask      = ^Perm(0)
+	Ext       = ^time.Duration(0)
+)
+`
+
+func TestEvalConstants(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "foo.go", constSource, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apkg, _ := ast.NewPackage(fset, map[string]*ast.File{"foo.go": file}, simpleImporter, nil)
+	actual := make(map[string]string)
+	for name, value := range evalConstants(apkg) {
+		actual[name.Name] = value
+	}
+	expected := map[string]string{
+		"Sunday":  "0",
+		"Monday":  "1",
+		"Tuesday": "2",
+		"KB":      "1024",
+		"MB":      "1048576",
+		"B":       "3",
+		"C":       `"ab"`,
+		"D":       "2",
+		"E":       "3",
+		"F":       "3.5",
+		"G":       "255",
+		"H":       "true",
+		"L":       "0",
+		"M":       "0",
+		"All":     "255",
+		"Read":    "254",
+		"Inv":     "1",
+		"Mask":    "255",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("evalConstants() = %v, want %v", actual, expected)
+	}
+}
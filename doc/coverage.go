@@ -0,0 +1,129 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/ast"
+	"go/doc"
+)
+
+// Coverage holds documentation coverage counts for a package or project.
+type Coverage struct {
+	// Number of exported consts, vars, funcs, types and methods.
+	Exported int
+
+	// Number of exported identifiers with a doc comment.
+	Documented int
+
+	// Number of exported funcs, types and methods. These are the identifiers
+	// that can have examples.
+	ExampleTargets int
+
+	// Number of exported funcs, types and methods with at least one example.
+	WithExamples int
+}
+
+// Add adds the counts in c2 to c.
+func (c *Coverage) Add(c2 Coverage) {
+	c.Exported += c2.Exported
+	c.Documented += c2.Documented
+	c.ExampleTargets += c2.ExampleTargets
+	c.WithExamples += c2.WithExamples
+}
+
+// DocFraction returns the fraction of exported identifiers with a doc
+// comment. DocFraction returns 1 if there are no exported identifiers.
+func (c Coverage) DocFraction() float64 {
+	if c.Exported == 0 {
+		return 1
+	}
+	return float64(c.Documented) / float64(c.Exported)
+}
+
+// ExampleFraction returns the fraction of exported funcs, types and methods
+// with an example. ExampleFraction returns 0 if there are no exported funcs,
+// types or methods.
+func (c Coverage) ExampleFraction() float64 {
+	if c.ExampleTargets == 0 {
+		return 0
+	}
+	return float64(c.WithExamples) / float64(c.ExampleTargets)
+}
+
+// isDocumentedSpec returns true if the value spec s in the declaration for v
+// has a doc comment, a line comment or is in a group with a doc comment.
+func isDocumentedSpec(v *doc.Value, s *ast.ValueSpec) bool {
+	return v.Doc != "" || s.Doc != nil || s.Comment != nil
+}
+
+func (c *Coverage) addValues(values []*doc.Value) {
+	for _, v := range values {
+		for _, spec := range v.Decl.Specs {
+			s, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			for _, name := range s.Names {
+				if !ast.IsExported(name.Name) {
+					continue
+				}
+				c.Exported++
+				if isDocumentedSpec(v, s) {
+					c.Documented++
+				}
+			}
+		}
+	}
+}
+
+func (c *Coverage) addFuncs(funcs []*Func) {
+	for _, f := range funcs {
+		c.Exported++
+		c.ExampleTargets++
+		if f.Doc != "" {
+			c.Documented++
+		}
+		if len(f.Examples) > 0 {
+			c.WithExamples++
+		}
+	}
+}
+
+// coverage computes the documentation coverage for the package. The values
+// are taken from dpkg because Value does not record comments on individual
+// specs.
+func coverage(pkg *Package, dpkg *doc.Package) Coverage {
+	var c Coverage
+	c.addValues(dpkg.Consts)
+	c.addValues(dpkg.Vars)
+	for _, t := range dpkg.Types {
+		c.addValues(t.Consts)
+		c.addValues(t.Vars)
+	}
+	c.addFuncs(pkg.Funcs)
+	for _, t := range pkg.Types {
+		c.Exported++
+		c.ExampleTargets++
+		if t.Doc != "" {
+			c.Documented++
+		}
+		if len(t.Examples) > 0 {
+			c.WithExamples++
+		}
+		c.addFuncs(t.Funcs)
+		c.addFuncs(t.Methods)
+	}
+	return c
+}
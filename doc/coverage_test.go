@@ -0,0 +1,71 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+const coverageSource = `// Package foo does things.
+package foo
+
+// Documented is documented.
+const Documented = 1
+
+const (
+	Undocumented = 1
+	Commented    = 2 // Commented has a line comment.
+	unexported   = 3
+)
+
+type T struct{}
+
+// M is a method.
+func (T) M() {}
+
+// F is a function.
+func F() {}
+`
+
+const coverageTestSource = `package foo
+
+func ExampleF() {}
+`
+
+func TestCoverage(t *testing.T) {
+	b := &builder{fset: token.NewFileSet(), srcs: make(map[string]*source)}
+	file, err := parser.ParseFile(b.fset, "foo.go", coverageSource, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFile, err := parser.ParseFile(b.fset, "foo_test.go", coverageTestSource, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.examples = doc.Examples(testFile)
+	apkg, _ := ast.NewPackage(b.fset, map[string]*ast.File{"foo.go": file}, simpleImporter, nil)
+	dpkg := doc.New(apkg, "example.com/foo", 0)
+	pkg := &Package{Funcs: b.funcs(dpkg.Funcs), Types: b.types(dpkg.Types)}
+
+	actual := coverage(pkg, dpkg)
+	expected := Coverage{Exported: 6, Documented: 4, ExampleTargets: 3, WithExamples: 1}
+	if actual != expected {
+		t.Errorf("coverage() = %+v, want %+v", actual, expected)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	APIAdded   = "added"
+	APIRemoved = "removed"
+	APIChanged = "changed"
+)
+
+// APIChange is a change to an exported declaration between two versions of
+// a package.
+type APIChange struct {
+	// One of APIAdded, APIRemoved or APIChanged.
+	Kind string `json:"kind"`
+
+	// Name of the declaration. Methods are named Type.Method.
+	Name string `json:"name"`
+
+	// Declarations before and after the change.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// stripComments returns the text of c with comments removed and all runs of
+// whitespace replaced by a single space.
+func stripComments(c Code) string {
+	var buf []byte
+	last := 0
+	for _, a := range c.Annotations {
+		if a.Kind == CommentAnnotation {
+			buf = append(buf, c.Text[last:a.Pos]...)
+			last = int(a.End)
+		}
+	}
+	buf = append(buf, c.Text[last:]...)
+	return strings.Join(strings.Fields(string(buf)), " ")
+}
+
+// addValueDecls adds the names declared in values to decls. The declaration
+// for a name is the line in the declaration group containing the name.
+func addValueDecls(decls map[string]string, values []*Value) {
+	for _, v := range values {
+		for _, a := range v.Decl.Annotations {
+			if a.Kind != AnchorAnnotation {
+				continue
+			}
+			i := strings.LastIndex(v.Decl.Text[:a.Pos], "\n") + 1
+			j := strings.Index(v.Decl.Text[a.Pos:], "\n")
+			if j < 0 {
+				j = len(v.Decl.Text)
+			} else {
+				j += int(a.Pos)
+			}
+			line := Code{Text: v.Decl.Text[i:j]}
+			for _, a := range v.Decl.Annotations {
+				if a.Kind == CommentAnnotation && int(a.Pos) >= i && int(a.End) <= j {
+					a.Pos -= int32(i)
+					a.End -= int32(i)
+					line.Annotations = append(line.Annotations, a)
+				}
+			}
+			decls[v.Decl.Text[a.Pos:a.End]] = stripComments(line)
+		}
+	}
+}
+
+func addFuncDecls(decls map[string]string, prefix string, funcs []*Func) {
+	for _, f := range funcs {
+		decls[prefix+f.Name] = stripComments(f.Decl)
+	}
+}
+
+// apiDecls returns the exported declarations in pdoc by name.
+func apiDecls(pdoc *Package) map[string]string {
+	decls := make(map[string]string)
+	addValueDecls(decls, pdoc.Consts)
+	addValueDecls(decls, pdoc.Vars)
+	addFuncDecls(decls, "", pdoc.Funcs)
+	for _, t := range pdoc.Types {
+		decls[t.Name] = stripComments(t.Decl)
+		addValueDecls(decls, t.Consts)
+		addValueDecls(decls, t.Vars)
+		addFuncDecls(decls, "", t.Funcs)
+		addFuncDecls(decls, t.Name+".", t.Methods)
+	}
+	return decls
+}
+
+type byAPIChangeName []*APIChange
+
+func (s byAPIChangeName) Len() int           { return len(s) }
+func (s byAPIChangeName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byAPIChangeName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// DiffAPI returns the changes to the exported declarations between the old
+// and new documentation for a package. DiffAPI returns nil if the exported
+// declarations are not available for both versions.
+func DiffAPI(old, new *Package) []*APIChange {
+	if old.Name == "" || new.Name == "" || old.Truncated || new.Truncated {
+		return nil
+	}
+	oldDecls := apiDecls(old)
+	newDecls := apiDecls(new)
+	var changes []*APIChange
+	for name, oldDecl := range oldDecls {
+		newDecl, ok := newDecls[name]
+		switch {
+		case !ok:
+			changes = append(changes, &APIChange{Kind: APIRemoved, Name: name, Old: oldDecl})
+		case oldDecl != newDecl:
+			changes = append(changes, &APIChange{Kind: APIChanged, Name: name, Old: oldDecl, New: newDecl})
+		}
+	}
+	for name, newDecl := range newDecls {
+		if _, ok := oldDecls[name]; !ok {
+			changes = append(changes, &APIChange{Kind: APIAdded, Name: name, New: newDecl})
+		}
+	}
+	sort.Sort(byAPIChangeName(changes))
+	return changes
+}
@@ -0,0 +1,87 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+const diffOldSource = `package foo
+
+const (
+	A = 1 // A is one.
+	B = 2
+)
+
+type T struct{}
+
+func (T) M(x int) {}
+
+func F() {}
+`
+
+const diffNewSource = `package foo
+
+const (
+	A = 1 // A is the loneliest number.
+	B = 3
+)
+
+type T struct{}
+
+func (T) M(x string) {}
+
+func G() {}
+`
+
+func buildTestPackage(t *testing.T, src string) *Package {
+	b := &builder{fset: token.NewFileSet(), srcs: make(map[string]*source)}
+	file, err := parser.ParseFile(b.fset, "foo.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apkg, _ := ast.NewPackage(b.fset, map[string]*ast.File{"foo.go": file}, simpleImporter, nil)
+	dpkg := doc.New(apkg, "example.com/foo", 0)
+	return &Package{
+		Name:   dpkg.Name,
+		Consts: b.values(dpkg.Consts),
+		Vars:   b.values(dpkg.Vars),
+		Funcs:  b.funcs(dpkg.Funcs),
+		Types:  b.types(dpkg.Types),
+	}
+}
+
+func TestDiffAPI(t *testing.T) {
+	old := buildTestPackage(t, diffOldSource)
+	new := buildTestPackage(t, diffNewSource)
+	actual := DiffAPI(old, new)
+	expected := []*APIChange{
+		{Kind: APIChanged, Name: "B", Old: "B = 2", New: "B = 3"},
+		{Kind: APIRemoved, Name: "F", Old: "func F()"},
+		{Kind: APIAdded, Name: "G", New: "func G()"},
+		{Kind: APIChanged, Name: "T.M", Old: "func (T) M(x int)", New: "func (T) M(x string)"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		for _, c := range actual {
+			t.Logf("%+v", c)
+		}
+		t.Errorf("DiffAPI returned unexpected changes")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strconv"
+)
+
+// Flag is a command-line flag declared by a command.
+type Flag struct {
+	Name    string
+	Type    string
+	Default string
+	Usage   string
+	Pos     Pos
+}
+
+// flagFuncs maps the names of the functions in the flag package to the
+// flag type and the index of the name argument. The default value, if any,
+// follows the name and the usage string is the last argument.
+var flagFuncs = map[string]struct {
+	typ  string
+	name int
+}{
+	"Bool":        {"bool", 0},
+	"Duration":    {"duration", 0},
+	"Float64":     {"float64", 0},
+	"Int":         {"int", 0},
+	"Int64":       {"int64", 0},
+	"String":      {"string", 0},
+	"Uint":        {"uint", 0},
+	"Uint64":      {"uint64", 0},
+	"BoolVar":     {"bool", 1},
+	"DurationVar": {"duration", 1},
+	"Float64Var":  {"float64", 1},
+	"IntVar":      {"int", 1},
+	"Int64Var":    {"int64", 1},
+	"StringVar":   {"string", 1},
+	"UintVar":     {"uint", 1},
+	"Uint64Var":   {"uint64", 1},
+	"Var":         {"value", 1},
+}
+
+type flagVisitor struct {
+	b     *builder
+	name  string // local name of the flag package
+	flags []*Flag
+}
+
+// stringLit returns the value of a string literal or a concatenation of
+// string literals.
+func stringLit(x ast.Expr) (string, bool) {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		if x.Kind == token.STRING {
+			s, err := strconv.Unquote(x.Value)
+			return s, err == nil
+		}
+	case *ast.ParenExpr:
+		return stringLit(x.X)
+	case *ast.BinaryExpr:
+		if x.Op == token.ADD {
+			l, ok := stringLit(x.X)
+			if !ok {
+				return "", false
+			}
+			r, ok := stringLit(x.Y)
+			return l + r, ok
+		}
+	}
+	return "", false
+}
+
+// exprString returns the value of string literal expressions and the source
+// of other expressions.
+func (v *flagVisitor) exprString(x ast.Expr) string {
+	if s, ok := stringLit(x); ok {
+		return s
+	}
+	v.b.buf = v.b.buf[:0]
+	if err := (&printer.Config{Mode: printer.UseSpaces, Tabwidth: 4}).Fprint(sliceWriter{&v.b.buf}, v.b.fset, x); err != nil {
+		return ""
+	}
+	return string(v.b.buf)
+}
+
+func (v *flagVisitor) Visit(n ast.Node) ast.Visitor {
+	call, ok := n.(*ast.CallExpr)
+	if !ok {
+		return v
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return v
+	}
+	if x, ok := sel.X.(*ast.Ident); !ok || x.Name != v.name || (x.Obj != nil && x.Obj.Kind != ast.Pkg) {
+		return v
+	}
+	f, ok := flagFuncs[sel.Sel.Name]
+	if !ok || len(call.Args) < f.name+2 {
+		return v
+	}
+	flag := &Flag{
+		Name:  v.exprString(call.Args[f.name]),
+		Type:  f.typ,
+		Usage: v.exprString(call.Args[len(call.Args)-1]),
+		Pos:   v.b.position(call),
+	}
+	if len(call.Args) == f.name+3 {
+		flag.Default = v.exprString(call.Args[f.name+1])
+	}
+	v.flags = append(v.flags, flag)
+	return v
+}
+
+type byFlagName []*Flag
+
+func (s byFlagName) Len() int           { return len(s) }
+func (s byFlagName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byFlagName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// flags returns the flags declared in package level variable declarations
+// and init functions in the package.
+func (b *builder) flags(apkg *ast.Package) []*Flag {
+	var flags []*Flag
+	for _, file := range apkg.Files {
+		v := &flagVisitor{b: b}
+		for _, spec := range file.Imports {
+			if importPath(spec) == "flag" {
+				v.name = "flag"
+				if spec.Name != nil {
+					v.name = spec.Name.Name
+				}
+			}
+		}
+		if v.name == "" || v.name == "_" || v.name == "." {
+			continue
+		}
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				if decl.Tok == token.VAR {
+					ast.Walk(v, decl)
+				}
+			case *ast.FuncDecl:
+				if decl.Recv == nil && decl.Name.Name == "init" && decl.Body != nil {
+					ast.Walk(v, decl.Body)
+				}
+			}
+		}
+		flags = append(flags, v.flags...)
+	}
+	sort.Sort(byFlagName(flags))
+	return flags
+}
@@ -0,0 +1,79 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+var flagsSources = map[string]string{
+	"a.go": `package main
+
+import (
+	"flag"
+	"time"
+)
+
+var (
+	addr    = flag.String("http", ":8080", "Listen for HTTP connections "+"on this address.")
+	timeout = flag.Duration("timeout", 5*time.Second, "Timeout.")
+	v       bool
+)
+
+func init() {
+	flag.BoolVar(&v, "v", false, "Verbose.")
+}
+
+func main() {
+	flag.Int("ignored", 1, "Not at package level.")
+}
+`,
+	"b.go": `package main
+
+import f "flag"
+
+var x = []struct{ n *int }{{n: f.Int("n", 3, "Count.")}}
+`,
+}
+
+func TestFlags(t *testing.T) {
+	b := &builder{fset: token.NewFileSet(), srcs: make(map[string]*source)}
+	files := make(map[string]*ast.File)
+	for name, src := range flagsSources {
+		file, err := parser.ParseFile(b.fset, name, src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = file
+	}
+	apkg, _ := ast.NewPackage(b.fset, files, simpleImporter, nil)
+	var actual []Flag
+	for _, f := range b.flags(apkg) {
+		actual = append(actual, Flag{Name: f.Name, Type: f.Type, Default: f.Default, Usage: f.Usage})
+	}
+	expected := []Flag{
+		{Name: "http", Type: "string", Default: ":8080", Usage: "Listen for HTTP connections on this address."},
+		{Name: "n", Type: "int", Default: "3", Usage: "Count."},
+		{Name: "timeout", Type: "duration", Default: "5 * time.Second", Usage: "Timeout."},
+		{Name: "v", Type: "bool", Default: "false", Usage: "Verbose."},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("flags() = %+v, want %+v", actual, expected)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"bytes"
+	"go/ast"
+	"go/doc"
+	"sort"
+	"strings"
+)
+
+// sigWriter writes method signatures with types qualified by import path.
+// Two methods with the same signature string have identical signatures.
+type sigWriter struct {
+	buf        bytes.Buffer
+	importPath string
+}
+
+func (w *sigWriter) fieldList(fields *ast.FieldList, sep string) {
+	if fields == nil {
+		return
+	}
+	i := 0
+	for _, f := range fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			if i > 0 {
+				w.buf.WriteString(sep)
+			}
+			w.expr(f.Type)
+			i++
+		}
+	}
+}
+
+func (w *sigWriter) signature(t *ast.FuncType) {
+	w.buf.WriteByte('(')
+	w.fieldList(t.Params, ", ")
+	w.buf.WriteByte(')')
+	if t.Results == nil || len(t.Results.List) == 0 {
+		return
+	}
+	w.buf.WriteByte(' ')
+	if len(t.Results.List) == 1 && len(t.Results.List[0].Names) <= 1 {
+		w.expr(t.Results.List[0].Type)
+		return
+	}
+	w.buf.WriteByte('(')
+	w.fieldList(t.Results, ", ")
+	w.buf.WriteByte(')')
+}
+
+func (w *sigWriter) expr(x ast.Expr) {
+	switch x := x.(type) {
+	case *ast.Ident:
+		if x.Obj == nil && predeclared[x.Name] == predeclaredType {
+			w.buf.WriteString(x.Name)
+		} else {
+			w.buf.WriteString(w.importPath)
+			w.buf.WriteByte('.')
+			w.buf.WriteString(x.Name)
+		}
+	case *ast.SelectorExpr:
+		if id, ok := x.X.(*ast.Ident); ok && id.Obj != nil && id.Obj.Kind == ast.Pkg {
+			if spec, ok := id.Obj.Decl.(*ast.ImportSpec); ok {
+				w.buf.WriteString(importPath(spec))
+				w.buf.WriteByte('.')
+				w.buf.WriteString(x.Sel.Name)
+				return
+			}
+		}
+		w.expr(x.X)
+		w.buf.WriteByte('.')
+		w.buf.WriteString(x.Sel.Name)
+	case *ast.StarExpr:
+		w.buf.WriteByte('*')
+		w.expr(x.X)
+	case *ast.ParenExpr:
+		w.expr(x.X)
+	case *ast.Ellipsis:
+		w.buf.WriteString("...")
+		w.expr(x.Elt)
+	case *ast.ArrayType:
+		w.buf.WriteByte('[')
+		if lit, ok := x.Len.(*ast.BasicLit); ok {
+			w.buf.WriteString(lit.Value)
+		} else if x.Len != nil {
+			w.buf.WriteString("...")
+		}
+		w.buf.WriteByte(']')
+		w.expr(x.Elt)
+	case *ast.MapType:
+		w.buf.WriteString("map[")
+		w.expr(x.Key)
+		w.buf.WriteByte(']')
+		w.expr(x.Value)
+	case *ast.ChanType:
+		switch x.Dir {
+		case ast.SEND:
+			w.buf.WriteString("chan<- ")
+		case ast.RECV:
+			w.buf.WriteString("<-chan ")
+		default:
+			w.buf.WriteString("chan ")
+		}
+		w.expr(x.Value)
+	case *ast.FuncType:
+		w.buf.WriteString("func")
+		w.signature(x)
+	case *ast.InterfaceType:
+		w.buf.WriteString("interface{")
+		for i, f := range x.Methods.List {
+			if i > 0 {
+				w.buf.WriteString("; ")
+			}
+			if len(f.Names) > 0 {
+				w.buf.WriteString(f.Names[0].Name)
+				if t, ok := f.Type.(*ast.FuncType); ok {
+					w.signature(t)
+				}
+			} else {
+				w.expr(f.Type)
+			}
+		}
+		w.buf.WriteByte('}')
+	case *ast.StructType:
+		w.buf.WriteString("struct{")
+		for i, f := range x.Fields.List {
+			if i > 0 {
+				w.buf.WriteString("; ")
+			}
+			for j, name := range f.Names {
+				if j > 0 {
+					w.buf.WriteString(", ")
+				}
+				w.buf.WriteString(name.Name)
+			}
+			if len(f.Names) > 0 {
+				w.buf.WriteByte(' ')
+			}
+			w.expr(f.Type)
+			if f.Tag != nil {
+				w.buf.WriteByte(' ')
+				w.buf.WriteString(f.Tag.Value)
+			}
+		}
+		w.buf.WriteByte('}')
+	default:
+		w.buf.WriteString("?")
+	}
+}
+
+// methodSignature returns the signature of the named method.
+func (w *sigWriter) methodSignature(name string, t *ast.FuncType) string {
+	w.buf.Reset()
+	w.buf.WriteString(name)
+	w.signature(t)
+	return w.buf.String()
+}
+
+// interfaceMethods adds the method signatures of the interface type with the
+// given name to sigs. Embedded interfaces declared in the package are
+// expanded. Embedded interfaces from other packages are added to embedded.
+// The function returns false if the method set cannot be determined.
+func (w *sigWriter) interfaceMethods(types map[string]*doc.Type, name string, sigs map[string]bool, embedded map[string]bool, seen map[string]bool) bool {
+	if seen[name] {
+		return true
+	}
+	seen[name] = true
+	t := types[name]
+	if t == nil {
+		return false
+	}
+	var it *ast.InterfaceType
+	for _, spec := range t.Decl.Specs {
+		if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == name {
+			it, _ = ts.Type.(*ast.InterfaceType)
+		}
+	}
+	if it == nil || it.Incomplete {
+		return false
+	}
+	for _, f := range it.Methods.List {
+		switch x := f.Type.(type) {
+		case *ast.FuncType:
+			for _, n := range f.Names {
+				sigs[w.methodSignature(n.Name, x)] = true
+			}
+		case *ast.Ident:
+			if !w.interfaceMethods(types, x.Name, sigs, embedded, seen) {
+				return false
+			}
+		case *ast.SelectorExpr:
+			w.buf.Reset()
+			w.expr(x)
+			embedded[w.buf.String()] = true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]bool) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// methodSets sets the method sets of the types in the package.
+func methodSets(importPath string, types []*Type, dtypes []*doc.Type) {
+	w := &sigWriter{importPath: importPath}
+	dtypeMap := make(map[string]*doc.Type)
+	for _, d := range dtypes {
+		dtypeMap[d.Name] = d
+	}
+	for i, d := range dtypes {
+		t := types[i]
+		isInterface := false
+		for _, spec := range d.Decl.Specs {
+			if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == d.Name {
+				_, isInterface = ts.Type.(*ast.InterfaceType)
+			}
+		}
+		sigs := make(map[string]bool)
+		if isInterface {
+			t.IsInterface = true
+			embedded := make(map[string]bool)
+			if w.interfaceMethods(dtypeMap, d.Name, sigs, embedded, make(map[string]bool)) {
+				t.MethodSet = sortedKeys(sigs)
+				t.EmbeddedInterfaces = sortedKeys(embedded)
+			}
+			continue
+		}
+		// Methods with pointer receivers, including methods promoted
+		// through embedded values, are in the method set of *T only.
+		ptrSigs := make(map[string]bool)
+		for _, m := range d.Methods {
+			sig := w.methodSignature(m.Name, m.Decl.Type)
+			ptrSigs[sig] = true
+			if !strings.HasPrefix(m.Recv, "*") {
+				sigs[sig] = true
+			}
+		}
+		t.MethodSet = sortedKeys(sigs)
+		if len(ptrSigs) > len(sigs) {
+			t.PtrMethodSet = sortedKeys(ptrSigs)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// LintMessage is a problem with a package found by a lint check.
+type LintMessage struct {
+	// Name of the check that found the problem.
+	Check string
+
+	// Position of the problem. Pos.Line is 0 if the problem does not have a
+	// position in the package files.
+	Pos Pos
+
+	Text string
+}
+
+// lintCheck is a check run on a package by the builder. A check sets one or
+// both of the file and pkg functions.
+type lintCheck struct {
+	name string
+
+	// If isError is true, then problems found by the check are also reported
+	// as package errors.
+	isError bool
+
+	// file is called for each Go file in the package before doc.New modifies
+	// the AST.
+	file func(l *linter, file *ast.File)
+
+	// pkg is called with the package documentation.
+	pkg func(l *linter, dpkg *doc.Package)
+}
+
+// lintChecks is the registry of checks run by the builder.
+var lintChecks = []*lintCheck{
+	{name: "importpath", isError: true, file: checkImportPaths},
+	{name: "go1", isError: true, file: checkDeprecatedExports},
+	{name: "unusedimport", file: checkUnusedImports},
+	{name: "undocumented", pkg: checkUndocumented},
+	{name: "synopsis", pkg: checkSynopsis},
+	{name: "exampleoutput", pkg: checkExampleOutput},
+}
+
+// linter holds the state used when running the lint checks.
+type linter struct {
+	b        *builder
+	pkg      *Package
+	check    *lintCheck
+	seen     map[string]bool
+	messages []*LintMessage
+}
+
+func (b *builder) newLinter(pkg *Package) *linter {
+	return &linter{b: b, pkg: pkg, seen: make(map[string]bool)}
+}
+
+// report records a problem found by the current check. Duplicate messages
+// are ignored.
+func (l *linter) report(pos token.Pos, format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	key := l.check.name + " " + text
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+	l.messages = append(l.messages, &LintMessage{
+		Check: l.check.name,
+		Pos:   l.b.position(posNode(pos)),
+		Text:  text,
+	})
+	if l.check.isError {
+		if pos.IsValid() {
+			text = fmt.Sprintf("%s (%s)", text, l.b.fset.Position(pos))
+		}
+		l.pkg.Errors = append(l.pkg.Errors, text)
+	}
+}
+
+// checkFiles runs the file checks on the files in apkg.
+func (l *linter) checkFiles(apkg *ast.Package) {
+	names := make([]string, 0, len(apkg.Files))
+	for name := range apkg.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, l.check = range lintChecks {
+		if l.check.file == nil {
+			continue
+		}
+		for _, name := range names {
+			l.check.file(l, apkg.Files[name])
+		}
+	}
+}
+
+// checkPackage runs the package checks on dpkg.
+func (l *linter) checkPackage(dpkg *doc.Package) {
+	for _, l.check = range lintChecks {
+		if l.check.pkg != nil {
+			l.check.pkg(l, dpkg)
+		}
+	}
+}
+
+func checkUnusedImports(l *linter, file *ast.File) {
+	used := make(map[*ast.ImportSpec]bool)
+	unknownQualifier := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		switch {
+		case x.Obj == nil:
+			// The qualifier is not resolved, probably because the package
+			// name guessed by simpleImporter is wrong. Give up.
+			unknownQualifier = true
+		case x.Obj.Kind == ast.Pkg:
+			if spec, _ := x.Obj.Decl.(*ast.ImportSpec); spec != nil {
+				used[spec] = true
+			}
+		}
+		return true
+	})
+	if unknownQualifier {
+		return
+	}
+	for _, spec := range file.Imports {
+		if spec.Name != nil && (spec.Name.Name == "_" || spec.Name.Name == ".") {
+			continue
+		}
+		if spec.Path.Value == `"C"` || used[spec] {
+			continue
+		}
+		l.report(spec.Pos(), "Import %s is not used", spec.Path.Value)
+	}
+}
+
+func checkUndocumentedValues(l *linter, kind string, values []*doc.Value) {
+	for _, v := range values {
+		for _, spec := range v.Decl.Specs {
+			s, ok := spec.(*ast.ValueSpec)
+			if !ok || isDocumentedSpec(v, s) {
+				continue
+			}
+			for _, name := range s.Names {
+				if ast.IsExported(name.Name) {
+					l.report(name.Pos(), "Exported %s %s should have a comment", kind, name.Name)
+				}
+			}
+		}
+	}
+}
+
+func checkUndocumentedFuncs(l *linter, recv string, funcs []*doc.Func) {
+	for _, f := range funcs {
+		if f.Doc != "" || f.Level > 0 {
+			continue
+		}
+		if recv == "" {
+			l.report(f.Decl.Pos(), "Exported function %s should have a comment", f.Name)
+		} else {
+			l.report(f.Decl.Pos(), "Exported method %s.%s should have a comment", recv, f.Name)
+		}
+	}
+}
+
+func checkUndocumented(l *linter, dpkg *doc.Package) {
+	if dpkg.Name == "main" {
+		return
+	}
+	checkUndocumentedValues(l, "const", dpkg.Consts)
+	checkUndocumentedValues(l, "var", dpkg.Vars)
+	checkUndocumentedFuncs(l, "", dpkg.Funcs)
+	for _, t := range dpkg.Types {
+		if t.Doc == "" {
+			l.report(t.Decl.Pos(), "Exported type %s should have a comment", t.Name)
+		}
+		checkUndocumentedValues(l, "const", t.Consts)
+		checkUndocumentedValues(l, "var", t.Vars)
+		checkUndocumentedFuncs(l, "", t.Funcs)
+		checkUndocumentedFuncs(l, t.Name, t.Methods)
+	}
+}
+
+func checkSynopsis(l *linter, dpkg *doc.Package) {
+	if dpkg.Name == "main" {
+		return
+	}
+	switch {
+	case strings.TrimSpace(dpkg.Doc) == "":
+		l.report(token.NoPos, "Package comment is missing")
+	case !strings.HasPrefix(dpkg.Doc, "Package "+dpkg.Name+" "):
+		l.report(token.NoPos, "Package comment should begin with \"Package %s \"", dpkg.Name)
+	}
+}
+
+func checkExampleOutput(l *linter, dpkg *doc.Package) {
+	for _, e := range l.b.examples {
+		if e.Output == "" && !e.EmptyOutput {
+			// Examples are in the test files. Report the problem without a
+			// position because the test files are not indexed in
+			// Package.Files.
+			l.report(token.NoPos, "Example%s is compiled but not run because it does not have an output comment", e.Name)
+		}
+	}
+}
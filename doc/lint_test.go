@@ -0,0 +1,99 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+const lintSource = `// Foo does things.
+package foo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Documented is documented.
+const Documented = 1
+
+const (
+	Undocumented = 1
+	Commented    = 2 // Commented has a line comment.
+)
+
+type T struct{}
+
+func (T) M() { fmt.Println(os.Args) }
+
+func F() error { return os.Error("x") }
+`
+
+const lintTestSource = `package foo
+
+func ExampleF() {
+}
+
+func ExampleT_M() {
+	// Output: hello
+}
+`
+
+var expectedLintMessages = []string{
+	`go1: "os".Error not found`,
+	`unusedimport: Import "bytes" is not used`,
+	`undocumented: Exported const Undocumented should have a comment`,
+	`undocumented: Exported function F should have a comment`,
+	`undocumented: Exported type T should have a comment`,
+	`undocumented: Exported method T.M should have a comment`,
+	`synopsis: Package comment should begin with "Package foo "`,
+	`exampleoutput: ExampleF is compiled but not run because it does not have an output comment`,
+}
+
+func TestLint(t *testing.T) {
+	b := &builder{fset: token.NewFileSet(), srcs: make(map[string]*source)}
+	file, err := parser.ParseFile(b.fset, "foo.go", lintSource, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFile, err := parser.ParseFile(b.fset, "foo_test.go", lintTestSource, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.examples = doc.Examples(testFile)
+
+	apkg, _ := ast.NewPackage(b.fset, map[string]*ast.File{"foo.go": file}, simpleImporter, nil)
+	pkg := &Package{}
+	l := b.newLinter(pkg)
+	l.checkFiles(apkg)
+	l.checkPackage(doc.New(apkg, "example.com/foo", 0))
+
+	var actual []string
+	for _, m := range l.messages {
+		actual = append(actual, m.Check+": "+m.Text)
+	}
+	if !reflect.DeepEqual(actual, expectedLintMessages) {
+		t.Errorf("lint messages = %#v, want %#v", actual, expectedLintMessages)
+	}
+	if len(pkg.Errors) != 1 {
+		t.Errorf("pkg.Errors = %v, want one error", pkg.Errors)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/garyburd/gosrc"
+)
+
+// IsLocalSubdir returns true if the directory with the given name should be
+// searched for packages. The go tool ignores directories that start with "."
+// or "_" and directories named "testdata".
+func IsLocalSubdir(name string) bool {
+	return name != "" && name[0] != '.' && name[0] != '_' && name != "testdata"
+}
+
+// GetLocal returns the documentation for the package in directory dir with
+// the given import path. The documentation is built from the Go files and
+// README files in the directory. The network is not used.
+func GetLocal(dir string, importPath string) (*Package, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.New()
+	d := &gosrc.Directory{
+		ImportPath:  importPath,
+		ProjectRoot: importPath,
+		ProjectName: path.Base(importPath),
+	}
+	for _, fi := range fis {
+		name := fi.Name()
+		switch {
+		case fi.IsDir():
+			if IsLocalSubdir(name) {
+				d.Subdirectories = append(d.Subdirectories, name)
+			}
+		case strings.HasSuffix(name, ".go") || readmePat.MatchString(name):
+			data, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			h.Write([]byte(name))
+			h.Write([]byte{0})
+			h.Write(data)
+			d.Files = append(d.Files, &gosrc.File{Name: name, Data: data})
+		}
+	}
+	sort.Strings(d.Subdirectories)
+	d.Etag = "local-" + hex.EncodeToString(h.Sum(nil))
+	return newPackage(d)
+}
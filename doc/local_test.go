@@ -0,0 +1,78 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gddo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"foo.go":            "// Package foo is a test.\npackage foo\n\n// F does nothing.\nfunc F() {}\n",
+		"README.md":         "# Foo\n",
+		"notes.txt":         "ignored\n",
+		"bar/bar.go":        "package bar\n",
+		"testdata/x.go":     "package x\n",
+		".hidden/hidden.go": "package hidden\n",
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pdoc, err := GetLocal(dir, "example.com/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdoc.Name != "foo" || pdoc.Synopsis != "Package foo is a test." {
+		t.Errorf("name, synopsis = %q, %q, want foo, Package foo is a test.", pdoc.Name, pdoc.Synopsis)
+	}
+	if len(pdoc.Funcs) != 1 || pdoc.Funcs[0].Name != "F" {
+		t.Errorf("unexpected funcs %v", pdoc.Funcs)
+	}
+	if pdoc.Readme == nil || pdoc.Readme.Name != "README.md" {
+		t.Errorf("readme = %v, want README.md", pdoc.Readme)
+	}
+	if !reflect.DeepEqual(pdoc.Subdirectories, []string{"bar"}) {
+		t.Errorf("subdirectories = %v, want [bar]", pdoc.Subdirectories)
+	}
+
+	etag := pdoc.Etag
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo.go"), []byte("package foo\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	pdoc, err = GetLocal(dir, "example.com/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdoc.Etag == etag {
+		t.Errorf("etag not changed after file update")
+	}
+}
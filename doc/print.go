@@ -24,15 +24,15 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/garyburd/gddo/doc"
-	"github.com/garyburd/gosrc"
 )
 
 var (
 	etag  = flag.String("etag", "", "Etag")
-	local = flag.Bool("local", false, "Get package from local directory.")
+	local = flag.Bool("local", false, "Get package from GOPATH.")
 )
 
 func main() {
@@ -47,10 +47,19 @@ func main() {
 		err  error
 	)
 	if *local {
-		gosrc.SetLocalDevMode(os.Getenv("GOPATH"))
+		for _, p := range filepath.SplitList(os.Getenv("GOPATH")) {
+			dir := filepath.Join(p, "src", filepath.FromSlash(path))
+			if fi, e := os.Stat(dir); e == nil && fi.IsDir() {
+				pdoc, err = doc.GetLocal(dir, path)
+				break
+			}
+		}
+		if pdoc == nil && err == nil {
+			log.Fatalf("%s not found in GOPATH", path)
+		}
+	} else {
+		pdoc, err = doc.Get(http.DefaultClient, path, *etag)
 	}
-	pdoc, err = doc.Get(http.DefaultClient, path, *etag)
-	//}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,210 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+)
+
+// sourceHash returns the hash used to identify the contents of a source
+// file.
+func sourceHash(data []byte) string {
+	h := sha1.Sum(data)
+	return hex.EncodeToString(h[:])
+}
+
+// sourceVisitor collects annotations for a source file.
+type sourceVisitor struct {
+	annotationVisitor
+	fset  *token.FileSet
+	file  *token.File
+	scope *ast.Scope
+}
+
+func (v *sourceVisitor) addNode(kind AnnotationKind, n ast.Node, path string) {
+	v.add(kind, path)
+	a := &v.annotations[len(v.annotations)-1]
+	a.Pos = int32(v.file.Offset(n.Pos()))
+	a.End = int32(v.file.Offset(n.End()))
+}
+
+// addAnchors adds anchors for the names in fields. The anchors are prefixed
+// with the type name.
+func (v *sourceVisitor) addAnchors(typeName string, fields *ast.FieldList) {
+	for _, f := range fields.List {
+		for _, name := range f.Names {
+			v.addNode(AnchorAnnotation, name, typeName)
+		}
+		ast.Walk(v, f.Type)
+	}
+}
+
+// decl annotates the top level declaration d.
+func (v *sourceVisitor) decl(d ast.Decl) {
+	switch d := d.(type) {
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				v.addNode(AnchorAnnotation, spec.Name, "")
+				switch t := spec.Type.(type) {
+				case *ast.StructType:
+					v.addAnchors(spec.Name.Name, t.Fields)
+				case *ast.InterfaceType:
+					v.addAnchors(spec.Name.Name, t.Methods)
+				default:
+					ast.Walk(v, t)
+				}
+			case *ast.ValueSpec:
+				for _, name := range spec.Names {
+					v.addNode(AnchorAnnotation, name, "")
+				}
+				if spec.Type != nil {
+					ast.Walk(v, spec.Type)
+				}
+				for _, x := range spec.Values {
+					ast.Walk(v, x)
+				}
+			case *ast.ImportSpec:
+				v.addNode(PackageLinkAnnotation, spec.Path, importPath(spec))
+			}
+		}
+	case *ast.FuncDecl:
+		typeName := ""
+		if d.Recv != nil {
+			ast.Walk(v, d.Recv)
+			if len(d.Recv.List) > 0 {
+				typeName = receiverTypeName(d.Recv.List[0].Type)
+			}
+		}
+		v.addNode(AnchorAnnotation, d.Name, typeName)
+		ast.Walk(v, d.Type)
+		if d.Body != nil {
+			ast.Walk(v, d.Body)
+		}
+	}
+}
+
+func (v *sourceVisitor) Visit(n ast.Node) ast.Visitor {
+	switch n := n.(type) {
+	case *ast.Ident:
+		switch {
+		case n.Obj == nil && predeclared[n.Name] != notPredeclared:
+			v.addNode(BuiltinAnnotation, n, "")
+		case n.Obj != nil && n.Obj.Kind != ast.Pkg && v.scope.Lookup(n.Name) == n.Obj && n.Obj.Pos() != n.Pos():
+			// Reference to package level declaration.
+			position := v.fset.Position(n.Obj.Pos())
+			v.addNode(FileLinkAnnotation, n, position.Filename)
+			v.annotations[len(v.annotations)-1].Line = int32(position.Line)
+		}
+	case *ast.SelectorExpr:
+		if x, _ := n.X.(*ast.Ident); x != nil {
+			if obj := x.Obj; obj != nil && obj.Kind == ast.Pkg {
+				if spec, _ := obj.Decl.(*ast.ImportSpec); spec != nil {
+					if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+						v.addNode(PackageLinkAnnotation, x, path)
+						if path != "C" {
+							v.addNode(LinkAnnotation, n.Sel, path)
+						}
+						return nil
+					}
+				}
+			}
+		}
+		ast.Walk(v, n.X)
+	default:
+		return v
+	}
+	return nil
+}
+
+func importPath(spec *ast.ImportSpec) string {
+	path, _ := strconv.Unquote(spec.Path.Value)
+	return path
+}
+
+func receiverTypeName(x ast.Expr) string {
+	switch x := x.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(x.X)
+	case *ast.Ident:
+		return x.Name
+	}
+	return ""
+}
+
+type byPos []Annotation
+
+func (s byPos) Len() int           { return len(s) }
+func (s byPos) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPos) Less(i, j int) bool { return s[i].Pos < s[j].Pos }
+
+// AnnotateSource returns the source for the file with the given name with
+// comments, declarations and references to other declarations annotated.
+// The argument files maps file names to the contents of the Go files in the
+// package. References to package level declarations are annotated with
+// FileLinkAnnotation. The file name is the path for the annotation.
+func AnnotateSource(files map[string][]byte, name string) (Code, error) {
+	data, ok := files[name]
+	if !ok {
+		return Code{}, errors.New("file not found")
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, data, parser.ParseComments)
+	if err != nil {
+		// Display the file without annotations.
+		return Code{Text: string(data)}, nil
+	}
+
+	// Parse the other files in the package to resolve references to
+	// declarations in those files.
+	pkgFiles := map[string]*ast.File{name: file}
+	for n, d := range files {
+		if n == name {
+			continue
+		}
+		f, err := parser.ParseFile(fset, n, d, 0)
+		if err != nil || f.Name.Name != file.Name.Name {
+			continue
+		}
+		pkgFiles[n] = f
+	}
+	apkg, _ := ast.NewPackage(fset, pkgFiles, simpleImporter, nil)
+
+	v := &sourceVisitor{
+		annotationVisitor: annotationVisitor{pathIndex: make(map[string]int)},
+		fset:              fset,
+		file:              fset.File(file.Pos()),
+		scope:             apkg.Scope,
+	}
+	for _, d := range file.Decls {
+		v.decl(d)
+	}
+	for _, g := range file.Comments {
+		for _, c := range g.List {
+			v.addNode(CommentAnnotation, c, "")
+		}
+	}
+	sort.Sort(byPos(v.annotations))
+	return Code{Text: string(data), Annotations: v.annotations, Paths: v.paths}, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"reflect"
+	"testing"
+)
+
+var annotateSourceFiles = map[string][]byte{
+	"a.go": []byte(`package foo
+
+import "strings"
+
+// T is a type.
+type T struct {
+	F int
+}
+
+func (t *T) M() string {
+	var s string
+	return strings.ToUpper(s) + g()
+}
+`),
+	"b.go": []byte(`package foo
+
+func g() string { return "" }
+`),
+}
+
+func TestAnnotateSource(t *testing.T) {
+	code, err := AnnotateSource(annotateSourceFiles, "a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type annotation struct {
+		Text string
+		Kind AnnotationKind
+		Path string
+		Line int32
+	}
+	var actual []annotation
+	for _, a := range code.Annotations {
+		var path string
+		if a.PathIndex >= 0 {
+			path = code.Paths[a.PathIndex]
+		}
+		actual = append(actual, annotation{code.Text[a.Pos:a.End], a.Kind, path, a.Line})
+	}
+	expected := []annotation{
+		{`"strings"`, PackageLinkAnnotation, "strings", 0},
+		{"// T is a type.", CommentAnnotation, "", 0},
+		{"T", AnchorAnnotation, "", 0},
+		{"F", AnchorAnnotation, "T", 0},
+		{"int", BuiltinAnnotation, "", 0},
+		{"T", FileLinkAnnotation, "a.go", 6},
+		{"M", AnchorAnnotation, "T", 0},
+		{"string", BuiltinAnnotation, "", 0},
+		{"string", BuiltinAnnotation, "", 0},
+		{"strings", PackageLinkAnnotation, "strings", 0},
+		{"ToUpper", LinkAnnotation, "strings", 0},
+		{"g", FileLinkAnnotation, "b.go", 3},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("AnnotateSource returned\n%+v\nwant\n%+v", actual, expected)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/ast"
+	"sort"
+)
+
+// usesVisitor collects the exported identifiers referenced from imported
+// packages.
+type usesVisitor struct {
+	imports map[string]string
+	uses    map[string]bool
+}
+
+func (v *usesVisitor) Visit(n ast.Node) ast.Visitor {
+	if n, ok := n.(*ast.SelectorExpr); ok {
+		// Identifiers that refer to imported packages are not resolved by the
+		// parser.
+		if x, _ := n.X.(*ast.Ident); x != nil && x.Obj == nil && ast.IsExported(n.Sel.Name) {
+			if path := v.imports[x.Name]; path != "" {
+				v.uses[path+"."+n.Sel.Name] = true
+			}
+		}
+	}
+	return v
+}
+
+// fileUses returns the sorted list of identifiers referenced by file from
+// imported packages. The identifiers are qualified by the import path of
+// the package: "import/path.Name".
+func fileUses(file *ast.File) []string {
+	v := &usesVisitor{imports: make(map[string]string), uses: make(map[string]bool)}
+	for _, spec := range file.Imports {
+		path := importPath(spec)
+		if path == "" || path == "C" {
+			continue
+		}
+		name := GuessPackageName(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == "" || name == "_" || name == "." {
+			continue
+		}
+		v.imports[name] = path
+	}
+	ast.Walk(v, file)
+	uses := make([]string, 0, len(v.uses))
+	for use := range v.uses {
+		uses = append(uses, use)
+	}
+	sort.Strings(uses)
+	return uses
+}
@@ -0,0 +1,53 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+const usesSource = `package foo
+
+import (
+	"net/http"
+	str "strings"
+	_ "image/png"
+	. "math"
+	"github.com/user/go-bar"
+)
+
+func F(w http.ResponseWriter, r *http.Request) {
+	http := 1
+	_ = http.X
+	_ = str.ToUpper(str.toLower(""))
+	_ = bar.Baz
+	_ = Pi
+}
+`
+
+func TestFileUses(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "foo.go", usesSource, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := fileUses(file)
+	expected := []string{"github.com/user/go-bar.Baz", "net/http.Request", "net/http.ResponseWriter", "strings.ToUpper"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("fileUses() = %v, want %v", actual, expected)
+	}
+}
@@ -15,9 +15,7 @@
 package doc
 
 import (
-	"fmt"
 	"go/ast"
-	"go/token"
 	"strconv"
 	"strings"
 
@@ -47,7 +45,7 @@ var deprecatedExports = map[string][]string{
 }
 
 type vetVisitor struct {
-	errors map[string]token.Pos
+	l *linter
 }
 
 func (v *vetVisitor) Visit(n ast.Node) ast.Visitor {
@@ -57,7 +55,7 @@ func (v *vetVisitor) Visit(n ast.Node) ast.Visitor {
 				if spec, _ := obj.Decl.(*ast.ImportSpec); spec != nil {
 					for _, name := range deprecatedExports[spec.Path.Value] {
 						if name == sel.Sel.Name {
-							v.errors[fmt.Sprintf("%s.%s not found", spec.Path.Value, sel.Sel.Name)] = n.Pos()
+							v.l.report(n.Pos(), "%s.%s not found", spec.Path.Value, sel.Sel.Name)
 							return nil
 						}
 					}
@@ -68,22 +66,17 @@ func (v *vetVisitor) Visit(n ast.Node) ast.Visitor {
 	return v
 }
 
-func (b *builder) vetPackage(pkg *Package, apkg *ast.Package) {
-	errors := make(map[string]token.Pos)
-	for _, file := range apkg.Files {
-		for _, is := range file.Imports {
-			importPath, _ := strconv.Unquote(is.Path.Value)
-			if !gosrc.IsValidPath(importPath) &&
-				!strings.HasPrefix(importPath, "exp/") &&
-				!strings.HasPrefix(importPath, "appengine") {
-				errors[fmt.Sprintf("Unrecognized import path %q", importPath)] = is.Pos()
-			}
+func checkDeprecatedExports(l *linter, file *ast.File) {
+	ast.Walk(&vetVisitor{l: l}, file)
+}
+
+func checkImportPaths(l *linter, file *ast.File) {
+	for _, is := range file.Imports {
+		importPath, _ := strconv.Unquote(is.Path.Value)
+		if !gosrc.IsValidPath(importPath) &&
+			!strings.HasPrefix(importPath, "exp/") &&
+			!strings.HasPrefix(importPath, "appengine") {
+			l.report(is.Pos(), "Unrecognized import path %q", importPath)
 		}
-		v := vetVisitor{errors: errors}
-		ast.Walk(&v, file)
-	}
-	for message, pos := range errors {
-		pkg.Errors = append(pkg.Errors,
-			fmt.Sprintf("%s (%s)", message, b.fset.Position(pos)))
 	}
 }
@@ -0,0 +1,99 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garyburd/gddo/database"
+)
+
+var apikeyCommand = &command{
+	name:  "apikey",
+	usage: "apikey add name | apikey revoke key | apikey list",
+}
+
+var apikeyQuota = apikeyCommand.flag.Float64("quota", 2000, "Request counter threshold for the key.")
+
+func init() {
+	apikeyCommand.run = apikey
+}
+
+func apikey(c *command) {
+	args := c.flag.Args()
+	if len(args) < 1 {
+		c.printUsage()
+		os.Exit(1)
+	}
+	db, err := database.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case args[0] == "add" && len(args) == 2:
+		p := make([]byte, 16)
+		if _, err := rand.Read(p); err != nil {
+			log.Fatal(err)
+		}
+		k := &database.APIKey{
+			Key:     hex.EncodeToString(p),
+			Name:    args[1],
+			Quota:   *apikeyQuota,
+			Created: time.Now().UTC(),
+		}
+		if err := db.PutAPIKey(k); err != nil {
+			log.Fatal(err)
+		}
+		putAudit(db, "apikey add", "", auditKey(k))
+		fmt.Println(k.Key)
+	case args[0] == "revoke" && len(args) == 2:
+		k, err := db.GetAPIKey(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if k == nil {
+			log.Fatalf("Key %s not found", args[1])
+		}
+		if err := db.DeleteAPIKey(k.Key); err != nil {
+			log.Fatal(err)
+		}
+		putAudit(db, "apikey revoke", "", auditKey(k))
+	case args[0] == "list" && len(args) == 1:
+		keys, err := db.APIKeys()
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%g\t%s\n", k.Key, k.Name, k.Quota, k.Created.Format(time.RFC3339))
+		}
+		w.Flush()
+	default:
+		c.printUsage()
+		os.Exit(1)
+	}
+}
+
+// auditKey describes a key in the audit log. The log is shown in the admin
+// console, so only a prefix of the key is recorded.
+func auditKey(k *database.APIKey) string {
+	return fmt.Sprintf("key %.8s... for %s", k.Key, k.Name)
+}
@@ -0,0 +1,161 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garyburd/gddo/database"
+)
+
+var (
+	blockCommand = &command{
+		name:  "block",
+		usage: "block [-reason text] [-expires duration] path",
+	}
+	unblockCommand = &command{
+		name:  "unblock",
+		usage: "unblock [-reason text] path",
+	}
+	deleteCommand = &command{
+		name:  "delete",
+		usage: "delete [-reason text] path",
+	}
+	crawlCommand = &command{
+		name:  "crawl",
+		usage: "crawl [-reason text] path",
+	}
+)
+
+var blockExpires = blockCommand.flag.Duration("expires", 0, "Lift the block after this duration. Zero blocks forever.")
+
+var pathCommands = []struct {
+	c      *command
+	reason *string
+	fn     func(db *database.Database, path, reason string) error
+}{
+	{blockCommand, blockCommand.flag.String("reason", "", "Reason recorded with the block and in the audit log."), block},
+	{unblockCommand, unblockCommand.flag.String("reason", "", "Reason recorded in the audit log."), ignoreReason((*database.Database).Unblock)},
+	{deleteCommand, deleteCommand.flag.String("reason", "", "Reason recorded in the audit log."), ignoreReason((*database.Database).Delete)},
+	{crawlCommand, crawlCommand.flag.String("reason", "", "Reason recorded in the audit log."), ignoreReason((*database.Database).ForceCrawl)},
+}
+
+func block(db *database.Database, path, reason string) error {
+	var expires time.Time
+	if *blockExpires > 0 {
+		expires = time.Now().Add(*blockExpires)
+	}
+	return db.Block(path, reason, expires)
+}
+
+func ignoreReason(fn func(*database.Database, string) error) func(*database.Database, string, string) error {
+	return func(db *database.Database, path, reason string) error { return fn(db, path) }
+}
+
+func init() {
+	for _, pc := range pathCommands {
+		pc := pc
+		pc.c.run = func(c *command) { runPathCommand(c, *pc.reason, pc.fn) }
+	}
+}
+
+// runPathCommand applies fn to the path argument and records the action in
+// the audit log.
+func runPathCommand(c *command, reason string, fn func(*database.Database, string, string) error) {
+	if len(c.flag.Args()) != 1 {
+		c.printUsage()
+		os.Exit(1)
+	}
+	path := c.flag.Args()[0]
+	db, err := database.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := fn(db, path, reason); err != nil {
+		log.Fatal(err)
+	}
+	putAudit(db, c.name, path, reason)
+}
+
+// putAudit records an action by the current user in the audit log.
+func putAudit(db *database.Database, action, path, reason string) {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if err := db.PutAudit(&database.AuditEntry{
+		Time:   time.Now().UTC(),
+		User:   name,
+		Action: action,
+		Path:   path,
+		Reason: reason,
+	}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var blockedCommand = &command{
+	name:  "blocked",
+	usage: "blocked",
+}
+
+var indexPrefixesCommand = &command{
+	name:  "index-prefixes",
+	usage: "index-prefixes",
+}
+
+func init() {
+	blockedCommand.run = blocked
+	indexPrefixesCommand.run = indexPrefixes
+}
+
+func blocked(c *command) {
+	db, err := database.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	blocks, err := db.ListBlocked()
+	if err != nil {
+		log.Fatal(err)
+	}
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	for _, b := range blocks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.Root, formatTime(b.Created), formatTime(b.Expires), b.Reason)
+	}
+	w.Flush()
+}
+
+// indexPrefixes adds the packages stored before the import path prefix index
+// was added to the index.
+func indexPrefixes(c *command) {
+	db, err := database.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.IndexPrefixes(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/garyburd/gddo/database"
+)
+
+var queuesCommand = &command{
+	name:  "queues",
+	usage: "queues [-n count]",
+}
+
+var queuesCount = queuesCommand.flag.Int("n", 20, "Number of entries to print from each queue.")
+
+var auditCommand = &command{
+	name:  "audit",
+	usage: "audit [-n count]",
+}
+
+var auditCount = auditCommand.flag.Int("n", 50, "Number of audit log entries to print.")
+
+func init() {
+	queuesCommand.run = queues
+	auditCommand.run = audit
+}
+
+func queues(c *command) {
+	db, err := database.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	q, err := db.CrawlQueues(*queuesCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Next crawl (%d):\n", q.NextCount)
+	for _, item := range q.Next {
+		fmt.Printf("  %s %s %s\n", item.Time.Format("2006-01-02 15:04:05"), item.Path, item.Schedule)
+	}
+	fmt.Printf("New crawl (%d):\n", q.NewCount)
+	for _, path := range q.New {
+		fmt.Printf("  %s\n", path)
+	}
+	fmt.Printf("Bad crawl (%d):\n", q.BadCount)
+	for _, path := range q.Bad {
+		fmt.Printf("  %s\n", path)
+	}
+}
+
+func audit(c *command) {
+	db, err := database.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	entries, err := db.AuditLog(*auditCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Time.Format("2006-01-02 15:04:05"), e.User, e.Action, e.Path, e.Reason)
+	}
+	w.Flush()
+}
@@ -0,0 +1,62 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Command gddo-crawler crawls packages for GoDoc.org. Several instances of
+// the crawler can run against the same database. Packages taken from the next
+// crawl queue are leased to one crawler and one crawler at a time reads the
+// GitHub updates.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/garyburd/gddo/crawler"
+	"github.com/garyburd/gddo/database"
+)
+
+var (
+	workers        = flag.Int("workers", 8, "Number of concurrent crawl workers.")
+	githubInterval = flag.Duration("github_interval", 0, "Read GitHub updates at this interval. Zero disables reading updates.")
+)
+
+func main() {
+	flag.Parse()
+	log.Printf("Starting crawler, os.Args=%s", strings.Join(os.Args, " "))
+
+	db, err := database.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.CheckLocal(false); err != nil {
+		log.Fatal(err)
+	}
+	c := crawler.New(db, crawler.HTTPClient)
+
+	if *githubInterval > 0 {
+		go func() {
+			for {
+				if err := c.ReadGitHubUpdates(3 * *githubInterval); err != nil {
+					log.Printf("GitHub updates: %v", err)
+				}
+				time.Sleep(*githubInterval)
+			}
+		}()
+	}
+
+	log.Fatal(c.RunPool(*workers))
+}
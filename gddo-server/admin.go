@@ -0,0 +1,200 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// This file implements the admin console. Operators authenticate with HTTP
+// basic authentication against the users in the -admin_users file. Every
+// action is recorded in the audit log.
+
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/garyburd/gddo/database"
+	"github.com/garyburd/indigo/web"
+)
+
+var adminUsersFile = flag.String("admin_users", "", "File containing user:password lines for the admin console. The console is disabled if not set.")
+
+const (
+	headerAuthorization   = "Authorization"
+	headerWWWAuthenticate = "Www-Authenticate"
+	headerOrigin          = "Origin"
+	headerReferer         = "Referer"
+)
+
+var (
+	errAdminPath        = errors.New("path required")
+	errAdminAction      = errors.New("unknown action")
+	errAdminCrossOrigin = errors.New("cross origin request")
+	errAdminExpires     = errors.New("invalid expiration duration")
+)
+
+// adminUsers maps admin user names to passwords.
+var adminUsers map[string]string
+
+func readAdminUsers(fname string) (map[string]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, errors.New("admin users: expected user:password, got " + line)
+		}
+		users[line[:i]] = line[i+1:]
+	}
+	return users, s.Err()
+}
+
+// adminUser returns the authenticated admin user for the request or "" if
+// the request is not authenticated.
+func adminUser(req *web.Request) string {
+	const prefix = "Basic "
+	auth := req.Header.Get(headerAuthorization)
+	if !strings.HasPrefix(auth, prefix) {
+		return ""
+	}
+	p, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
+	if err != nil {
+		return ""
+	}
+	i := strings.Index(string(p), ":")
+	if i < 0 {
+		return ""
+	}
+	user, password := string(p[:i]), string(p[i+1:])
+	expected, ok := adminUsers[user]
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+		return ""
+	}
+	return user
+}
+
+// sameOrigin returns true if the Origin or Referer header of the request
+// refers to the requested host. Browsers send basic authentication
+// credentials with cross site form posts, so actions must check the origin.
+func sameOrigin(req *web.Request) bool {
+	s := req.Header.Get(headerOrigin)
+	if s == "" {
+		s = req.Header.Get(headerReferer)
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Host == req.URL.Host
+}
+
+// adminHandler returns a handler that calls fn with the authenticated admin
+// user.
+func adminHandler(fn func(web.Response, *web.Request, string) error) web.Handler {
+	return web.HandlerFunc(func(resp web.Response, req *web.Request) error {
+		if adminUsers == nil {
+			return &web.Error{Status: web.StatusNotFound}
+		}
+		user := adminUser(req)
+		if user == "" {
+			resp.Start(web.StatusUnauthorized, web.Header{
+				headerWWWAuthenticate: {`Basic realm="GoDoc admin"`},
+				web.HeaderContentType: {"text/plain; charset=utf-8"},
+			}).Write([]byte(web.StatusText(web.StatusUnauthorized)))
+			return nil
+		}
+		return fn(resp, req, user)
+	})
+}
+
+func serveAdmin(resp web.Response, req *web.Request, user string) error {
+	queues, err := db.CrawlQueues(100)
+	if err != nil {
+		return err
+	}
+	audit, err := db.AuditLog(100)
+	if err != nil {
+		return err
+	}
+	blocks, err := db.ListBlocked()
+	if err != nil {
+		return err
+	}
+	return executeTemplate(resp, "admin.html", web.StatusOK, nil, map[string]interface{}{
+		"user":   user,
+		"queues": queues,
+		"audit":  audit,
+		"blocks": blocks,
+	})
+}
+
+func serveAdminAction(resp web.Response, req *web.Request, user string) error {
+	if !sameOrigin(req) {
+		return &web.Error{Status: web.StatusForbidden, Reason: errAdminCrossOrigin}
+	}
+	action := req.Form.Get("action")
+	path := strings.TrimSpace(req.Form.Get("path"))
+	if path == "" {
+		return &web.Error{Status: web.StatusBadRequest, Reason: errAdminPath}
+	}
+	reason := strings.TrimSpace(req.Form.Get("reason"))
+	var err error
+	switch action {
+	case "block":
+		var expires time.Time
+		if s := strings.TrimSpace(req.Form.Get("expires")); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return &web.Error{Status: web.StatusBadRequest, Reason: errAdminExpires}
+			}
+			expires = time.Now().Add(d)
+		}
+		err = db.Block(path, reason, expires)
+	case "unblock":
+		err = db.Unblock(path)
+	case "delete":
+		err = db.Delete(path)
+	case "crawl":
+		err = db.ForceCrawl(path)
+	default:
+		return &web.Error{Status: web.StatusBadRequest, Reason: errAdminAction}
+	}
+	if err != nil {
+		return err
+	}
+	e := &database.AuditEntry{
+		Time:   time.Now().UTC(),
+		User:   user,
+		Action: action,
+		Path:   path,
+		Reason: reason,
+	}
+	log.Printf("Admin %s %s %s %q", e.User, e.Action, e.Path, e.Reason)
+	if err := db.PutAudit(e); err != nil {
+		return err
+	}
+	return web.Redirect(resp, req, "/-/admin", 302, nil)
+}
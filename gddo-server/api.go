@@ -0,0 +1,296 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// This file implements version 1 of the API. List endpoints return a page of
+// results and a cursor for the next page. All responses have an entity tag
+// and errors have a machine-readable code.
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/garyburd/gddo/database"
+	"github.com/garyburd/gddo/doc"
+	"github.com/garyburd/gosrc"
+	"github.com/garyburd/indigo/web"
+)
+
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+)
+
+var (
+	errBlocked       = errors.New("blocked")
+	errInvalidCursor = errors.New("invalid cursor")
+	errInvalidLimit  = errors.New("invalid limit")
+)
+
+func addAPIV1Routes(r *web.Router) {
+	r.Add("/v1/search").Get(apiV1ListHandler(apiSearchResults))
+	r.Add("/v1/packages").Get(apiV1PageHandler(apiPackagesPage))
+	r.Add("/v1/importers/<path:.+>").Get(apiV1PageHandler(apiImportersPage))
+	r.Add("/v1/imports/<path:.+>").Get(apiV1ListHandler(apiImportsResults))
+	r.Add("/v1/changes/<path:.+>").Get(apiV1PageHandler(apiChangesPage))
+	r.Add("/v1/usedby/<path:.+>").Get(apiV1PageHandler(apiUsedByPage))
+	r.Add("/v1/fields/<path:.+>").Get(apiV1ListHandler(apiFieldsResults))
+	r.Add("/v1/implementations/<path:.+>").Get(apiV1ListHandler(apiImplementationsResults))
+	r.Add("/v1/implements/<path:.+>").Get(apiV1ListHandler(apiImplementsResults))
+	r.Add("/v1/doc/<path:.+>").GetFunc(serveAPIV1Doc)
+	r.Add("/v1/graph/<path:.+>").GetFunc(serveAPIV1Graph)
+}
+
+// apiErrorInfo is the body of an API error response.
+type apiErrorInfo struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var apiStatusCodes = map[int]string{
+	web.StatusBadRequest:       "bad_request",
+	web.StatusForbidden:        "forbidden",
+	web.StatusNotFound:         "not_found",
+	web.StatusMethodNotAllowed: "method_not_allowed",
+}
+
+// classifyAPIError returns the HTTP status and error information for an
+// error returned from an API handler. The status argument is the status
+// determined by the web package.
+func classifyAPIError(status int, err error) (int, apiErrorInfo) {
+	if e, ok := err.(*web.Error); ok && e.Reason != nil {
+		err = e.Reason
+	}
+	switch e := err.(type) {
+	case *gosrc.RemoteError:
+		return web.StatusBadGateway, apiErrorInfo{"upstream_error", "Error getting package files from " + e.Host + "."}
+	case gosrc.NotFoundError:
+		return web.StatusNotFound, apiErrorInfo{"not_found", e.Message}
+	}
+	switch err {
+	case errUpdateTimeout:
+		return web.StatusGatewayTimeout, apiErrorInfo{"timeout", "Timeout getting package files from the version control system."}
+	case errBlocked:
+		return web.StatusForbidden, apiErrorInfo{"blocked", "The package is blocked."}
+	case errInvalidCursor:
+		return web.StatusBadRequest, apiErrorInfo{"invalid_cursor", "The cursor is not valid."}
+	case errInvalidLimit:
+		return web.StatusBadRequest, apiErrorInfo{"invalid_limit", fmt.Sprintf("The limit must be between 1 and %d.", apiMaxLimit)}
+	}
+	code, ok := apiStatusCodes[status]
+	if !ok {
+		code = "internal_error"
+	}
+	return status, apiErrorInfo{code, web.StatusText(status)}
+}
+
+// writeAPIResponse writes data as JSON with an entity tag computed from the
+// response body. The body is omitted if the request has a matching
+// If-None-Match header.
+func writeAPIResponse(resp web.Response, req *web.Request, data interface{}) error {
+	p, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	p = append(p, '\n')
+	etag := fmt.Sprintf(`"%x"`, md5.Sum(p))
+	header := web.Header{
+		web.HeaderContentType: {"application/json; charset=utf-8"},
+		web.HeaderEtag:        {etag},
+	}
+	if req.Header.Get(web.HeaderIfNoneMatch) == etag {
+		resp.Start(web.StatusNotModified, header)
+		return nil
+	}
+	_, err = resp.Start(web.StatusOK, header).Write(p)
+	return err
+}
+
+// encodeAPICursor returns the cursor for the page starting at offset. For
+// /v1/packages, the offset is the last package id on the previous page.
+func encodeAPICursor(offset int) string {
+	return base64.URLEncoding.EncodeToString([]byte("o" + strconv.Itoa(offset)))
+}
+
+// apiPage returns the offset and limit of the requested page.
+func apiPage(req *web.Request) (offset, limit int, err error) {
+	limit = apiDefaultLimit
+	if s := req.Form.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > apiMaxLimit {
+			return 0, 0, &web.Error{Status: web.StatusBadRequest, Reason: errInvalidLimit}
+		}
+	}
+	if s := req.Form.Get("cursor"); s != "" {
+		p, err := base64.URLEncoding.DecodeString(s)
+		if err != nil || len(p) < 2 || p[0] != 'o' {
+			return 0, 0, &web.Error{Status: web.StatusBadRequest, Reason: errInvalidCursor}
+		}
+		offset, err = strconv.Atoi(string(p[1:]))
+		if err != nil || offset < 0 {
+			return 0, 0, &web.Error{Status: web.StatusBadRequest, Reason: errInvalidCursor}
+		}
+	}
+	return offset, limit, nil
+}
+
+// apiListPage is the response for a list endpoint.
+type apiListPage struct {
+	Results interface{} `json:"results"`
+	Next    string      `json:"next,omitempty"`
+}
+
+// pageAPIResults returns the requested page of the slice results.
+func pageAPIResults(results interface{}, offset, limit int) *apiListPage {
+	v := reflect.ValueOf(results)
+	n := v.Len()
+	if offset > n {
+		offset = n
+	}
+	end := offset + limit
+	page := &apiListPage{}
+	if end < n {
+		page.Next = encodeAPICursor(end)
+	} else {
+		end = n
+	}
+	if offset == end {
+		// Encode empty results as [] instead of null.
+		page.Results = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+	} else {
+		page.Results = v.Slice(offset, end).Interface()
+	}
+	return page
+}
+
+// apiV1ListHandler returns a handler for a list endpoint that responds with
+// a page of the results returned by fn. It is used for lists that are
+// bounded by the size of a package: search results, imports, fields and
+// implementations.
+func apiV1ListHandler(fn func(*web.Request) (interface{}, error)) web.Handler {
+	return web.HandlerFunc(func(resp web.Response, req *web.Request) error {
+		offset, limit, err := apiPage(req)
+		if err != nil {
+			return err
+		}
+		results, err := fn(req)
+		if err != nil {
+			return err
+		}
+		return writeAPIResponse(resp, req, pageAPIResults(results, offset, limit))
+	})
+}
+
+// apiV1PageHandler returns a handler for a list endpoint where fn returns the
+// requested page of results and the offset of the next page, or zero if no
+// results follow the page. It is used for lists that grow with the corpus.
+func apiV1PageHandler(fn func(req *web.Request, offset, limit int) (interface{}, int, error)) web.Handler {
+	return web.HandlerFunc(func(resp web.Response, req *web.Request) error {
+		offset, limit, err := apiPage(req)
+		if err != nil {
+			return err
+		}
+		results, next, err := fn(req, offset, limit)
+		if err != nil {
+			return err
+		}
+		page := &apiListPage{Results: results}
+		if next > 0 {
+			page.Next = encodeAPICursor(next)
+		}
+		return writeAPIResponse(resp, req, page)
+	})
+}
+
+// nextOffset returns the offset of the page after the page at offset.
+func nextOffset(offset, limit int, more bool) int {
+	if !more {
+		return 0
+	}
+	return offset + limit
+}
+
+func apiPackagesPage(req *web.Request, offset, limit int) (interface{}, int, error) {
+	return db.PackagesPage(offset, limit)
+}
+
+func apiImportersPage(req *web.Request, offset, limit int) (interface{}, int, error) {
+	pkgs, more, err := db.ImportersPage(req.RouteVars["path"], offset, limit)
+	return pkgs, nextOffset(offset, limit, more), err
+}
+
+func apiUsedByPage(req *web.Request, offset, limit int) (interface{}, int, error) {
+	importPath, name, err := splitAPIName(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	pkgs, more, err := db.UsedByPage(importPath, name, offset, limit)
+	return pkgs, nextOffset(offset, limit, more), err
+}
+
+func apiChangesPage(req *web.Request, offset, limit int) (interface{}, int, error) {
+	changes, more, err := db.ChangesPage(req.RouteVars["path"], offset, limit)
+	return changes, nextOffset(offset, limit, more), err
+}
+
+// getAPIDoc returns the documentation for the route path. The package is
+// fetched from the version control system if it has not been seen before.
+func getAPIDoc(req *web.Request) (*doc.Package, []database.Package, error) {
+	importPath := req.RouteVars["path"]
+	pdoc, pkgs, err := getDoc(importPath, queryRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pdoc == nil && len(pkgs) == 0 {
+		if blocked, err := db.IsBlocked(importPath); err != nil {
+			return nil, nil, err
+		} else if blocked {
+			return nil, nil, &web.Error{Status: web.StatusForbidden, Reason: errBlocked}
+		}
+		return nil, nil, &web.Error{Status: web.StatusNotFound}
+	}
+	return pdoc, pkgs, nil
+}
+
+func serveAPIV1Doc(resp web.Response, req *web.Request) error {
+	pdoc, pkgs, err := getAPIDoc(req)
+	if err != nil {
+		return err
+	}
+	if pdoc == nil {
+		pdoc = &doc.Package{ImportPath: req.RouteVars["path"]}
+	}
+	return writeAPIResponse(resp, req, newAPIDoc(pdoc, pkgs))
+}
+
+func serveAPIV1Graph(resp web.Response, req *web.Request) error {
+	pdoc, _, err := getAPIDoc(req)
+	if err != nil {
+		return err
+	}
+	if pdoc == nil || pdoc.Name == "" {
+		return &web.Error{Status: web.StatusNotFound}
+	}
+	data, err := newAPIGraph(pdoc, req.Form.Get("hide") == "1")
+	if err != nil {
+		return err
+	}
+	return writeAPIResponse(resp, req, data)
+}
@@ -0,0 +1,98 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/garyburd/gosrc"
+	"github.com/garyburd/indigo/web"
+)
+
+var pageAPIResultsTests = []struct {
+	results       []string
+	offset, limit int
+	page          []string
+	next          int
+}{
+	{[]string{"a", "b", "c"}, 0, 2, []string{"a", "b"}, 2},
+	{[]string{"a", "b", "c"}, 2, 2, []string{"c"}, -1},
+	{[]string{"a", "b", "c"}, 0, 3, []string{"a", "b", "c"}, -1},
+	{[]string{"a", "b", "c"}, 5, 2, []string{}, -1},
+	{nil, 0, 2, []string{}, -1},
+}
+
+func TestPageAPIResults(t *testing.T) {
+	for _, tt := range pageAPIResultsTests {
+		page := pageAPIResults(tt.results, tt.offset, tt.limit)
+		if !reflect.DeepEqual(page.Results, tt.page) {
+			t.Errorf("pageAPIResults(%v, %d, %d) results = %v, want %v", tt.results, tt.offset, tt.limit, page.Results, tt.page)
+		}
+		next := ""
+		if tt.next >= 0 {
+			next = encodeAPICursor(tt.next)
+		}
+		if page.Next != next {
+			t.Errorf("pageAPIResults(%v, %d, %d) next = %q, want %q", tt.results, tt.offset, tt.limit, page.Next, next)
+		}
+	}
+}
+
+var apiPageTests = []struct {
+	form          url.Values
+	offset, limit int
+	ok            bool
+}{
+	{url.Values{}, 0, apiDefaultLimit, true},
+	{url.Values{"limit": {"10"}, "cursor": {encodeAPICursor(20)}}, 20, 10, true},
+	{url.Values{"limit": {"0"}}, 0, 0, false},
+	{url.Values{"limit": {"100000"}}, 0, 0, false},
+	{url.Values{"cursor": {"xyz"}}, 0, 0, false},
+}
+
+func TestAPIPage(t *testing.T) {
+	for _, tt := range apiPageTests {
+		offset, limit, err := apiPage(&web.Request{Form: tt.form})
+		if (err == nil) != tt.ok || offset != tt.offset || limit != tt.limit {
+			t.Errorf("apiPage(%v) = %d, %d, %v, want %d, %d, ok=%v", tt.form, offset, limit, err, tt.offset, tt.limit, tt.ok)
+		}
+	}
+}
+
+var classifyAPIErrorTests = []struct {
+	status int
+	err    error
+	code   string
+	result int
+}{
+	{web.StatusNotFound, &web.Error{Status: web.StatusNotFound}, "not_found", web.StatusNotFound},
+	{web.StatusNotFound, &web.Error{Status: web.StatusNotFound, Reason: errUpdateTimeout}, "timeout", web.StatusGatewayTimeout},
+	{web.StatusForbidden, &web.Error{Status: web.StatusForbidden, Reason: errBlocked}, "blocked", web.StatusForbidden},
+	{web.StatusInternalServerError, &gosrc.RemoteError{Host: "github.com"}, "upstream_error", web.StatusBadGateway},
+	{web.StatusInternalServerError, errUpdateTimeout, "timeout", web.StatusGatewayTimeout},
+	{web.StatusInternalServerError, errors.New("x"), "internal_error", web.StatusInternalServerError},
+}
+
+func TestClassifyAPIError(t *testing.T) {
+	for _, tt := range classifyAPIErrorTests {
+		status, info := classifyAPIError(tt.status, tt.err)
+		if status != tt.result || info.Code != tt.code {
+			t.Errorf("classifyAPIError(%d, %v) = %d, %q, want %d, %q", tt.status, tt.err, status, info.Code, tt.result, tt.code)
+		}
+	}
+}
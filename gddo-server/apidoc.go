@@ -0,0 +1,330 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// This file implements the JSON representation of package documentation
+// served by the API. The API types are separate from the doc package types
+// so that the JSON field names do not change when the stored documentation
+// changes.
+
+package main
+
+import (
+	"time"
+
+	"github.com/garyburd/gddo/database"
+	"github.com/garyburd/gddo/doc"
+)
+
+type apiPos struct {
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+	Lines int    `json:"lines"`
+}
+
+type apiAnnotation struct {
+	Kind string `json:"kind"`
+	Pos  int    `json:"pos"`
+	End  int    `json:"end"`
+	Path string `json:"path,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+type apiCode struct {
+	Text        string          `json:"text"`
+	Annotations []apiAnnotation `json:"annotations,omitempty"`
+}
+
+type apiExample struct {
+	Name   string  `json:"name,omitempty"`
+	Doc    string  `json:"doc,omitempty"`
+	Code   apiCode `json:"code"`
+	Output string  `json:"output,omitempty"`
+	Play   bool    `json:"play,omitempty"`
+}
+
+// apiConstValue is the evaluated value of a constant. Values are listed in
+// declaration order.
+type apiConstValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type apiValue struct {
+	Decl       apiCode         `json:"decl"`
+	Pos        *apiPos         `json:"pos,omitempty"`
+	Doc        string          `json:"doc,omitempty"`
+	Deprecated string          `json:"deprecated,omitempty"`
+	Values     []apiConstValue `json:"values,omitempty"`
+}
+
+type apiFunc struct {
+	Name       string       `json:"name"`
+	Recv       string       `json:"recv,omitempty"`
+	Decl       apiCode      `json:"decl"`
+	Pos        *apiPos      `json:"pos,omitempty"`
+	Doc        string       `json:"doc,omitempty"`
+	Deprecated string       `json:"deprecated,omitempty"`
+	Examples   []apiExample `json:"examples,omitempty"`
+}
+
+type apiType struct {
+	Name        string       `json:"name"`
+	Decl        apiCode      `json:"decl"`
+	Pos         *apiPos      `json:"pos,omitempty"`
+	Doc         string       `json:"doc,omitempty"`
+	Deprecated  string       `json:"deprecated,omitempty"`
+	IsInterface bool         `json:"isInterface,omitempty"`
+	Fields      []apiField   `json:"fields,omitempty"`
+	Consts      []apiValue   `json:"consts,omitempty"`
+	Vars        []apiValue   `json:"vars,omitempty"`
+	Funcs       []apiFunc    `json:"funcs,omitempty"`
+	Methods     []apiFunc    `json:"methods,omitempty"`
+	Examples    []apiExample `json:"examples,omitempty"`
+}
+
+type apiNote struct {
+	UID  string  `json:"uid"`
+	Body string  `json:"body"`
+	Pos  *apiPos `json:"pos,omitempty"`
+}
+
+type apiFlag struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Default string  `json:"default,omitempty"`
+	Usage   string  `json:"usage,omitempty"`
+	Pos     *apiPos `json:"pos,omitempty"`
+}
+
+type apiFile struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type apiReadme struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+	Text string `json:"text"`
+}
+
+type apiDoc struct {
+	ImportPath     string               `json:"importPath"`
+	Name           string               `json:"name,omitempty"`
+	IsCommand      bool                 `json:"isCommand,omitempty"`
+	Synopsis       string               `json:"synopsis,omitempty"`
+	Doc            string               `json:"doc,omitempty"`
+	Deprecated     string               `json:"deprecated,omitempty"`
+	ProjectRoot    string               `json:"projectRoot,omitempty"`
+	ProjectName    string               `json:"projectName,omitempty"`
+	ProjectURL     string               `json:"projectURL,omitempty"`
+	VCS            string               `json:"vcs,omitempty"`
+	BrowseURL      string               `json:"browseURL,omitempty"`
+	Updated        time.Time            `json:"updated"`
+	Truncated      bool                 `json:"truncated,omitempty"`
+	GOOS           string               `json:"goos,omitempty"`
+	GOARCH         string               `json:"goarch,omitempty"`
+	Errors         []string             `json:"errors,omitempty"`
+	Consts         []apiValue           `json:"consts,omitempty"`
+	Vars           []apiValue           `json:"vars,omitempty"`
+	Funcs          []apiFunc            `json:"funcs,omitempty"`
+	Types          []apiType            `json:"types,omitempty"`
+	Examples       []apiExample         `json:"examples,omitempty"`
+	Flags          []apiFlag            `json:"flags,omitempty"`
+	Notes          map[string][]apiNote `json:"notes,omitempty"`
+	Readme         *apiReadme           `json:"readme,omitempty"`
+	Files          []apiFile            `json:"files,omitempty"`
+	TestFiles      []apiFile            `json:"testFiles,omitempty"`
+	Imports        []string             `json:"imports,omitempty"`
+	TestImports    []string             `json:"testImports,omitempty"`
+	XTestImports   []string             `json:"xtestImports,omitempty"`
+	Subdirectories []database.Package   `json:"subdirectories,omitempty"`
+}
+
+var apiAnnotationKinds = map[doc.AnnotationKind]string{
+	doc.LinkAnnotation:        "link",
+	doc.AnchorAnnotation:      "anchor",
+	doc.CommentAnnotation:     "comment",
+	doc.PackageLinkAnnotation: "packageLink",
+	doc.BuiltinAnnotation:     "builtin",
+	doc.FileLinkAnnotation:    "fileLink",
+}
+
+// apiDocBuilder converts documentation to the API representation.
+type apiDocBuilder struct {
+	pdoc *doc.Package
+}
+
+func (b *apiDocBuilder) pos(pos doc.Pos) *apiPos {
+	if pos.Line == 0 || int(pos.File) < 0 || int(pos.File) >= len(b.pdoc.Files) {
+		return nil
+	}
+	return &apiPos{File: b.pdoc.Files[pos.File].Name, Line: int(pos.Line), Lines: int(pos.N) + 1}
+}
+
+func (b *apiDocBuilder) code(c doc.Code) apiCode {
+	result := apiCode{Text: c.Text}
+	for _, a := range c.Annotations {
+		aa := apiAnnotation{Kind: apiAnnotationKinds[a.Kind], Pos: int(a.Pos), End: int(a.End)}
+		if a.PathIndex >= 0 && int(a.PathIndex) < len(c.Paths) {
+			aa.Path = c.Paths[a.PathIndex]
+		}
+		if a.Kind == doc.FileLinkAnnotation {
+			aa.Line = int(a.Line)
+		}
+		result.Annotations = append(result.Annotations, aa)
+	}
+	return result
+}
+
+func (b *apiDocBuilder) examples(examples []*doc.Example) []apiExample {
+	var result []apiExample
+	for _, e := range examples {
+		result = append(result, apiExample{
+			Name:   e.Name,
+			Doc:    e.Doc,
+			Code:   b.code(e.Code),
+			Output: e.Output,
+			Play:   e.Play != "",
+		})
+	}
+	return result
+}
+
+func (b *apiDocBuilder) values(values []*doc.Value) []apiValue {
+	var result []apiValue
+	for _, v := range values {
+		av := apiValue{
+			Decl:       b.code(v.Decl),
+			Pos:        b.pos(v.Pos),
+			Doc:        v.Doc,
+			Deprecated: v.Deprecated,
+		}
+		for _, cv := range v.Values {
+			av.Values = append(av.Values, apiConstValue{Name: cv.Name, Value: cv.Value})
+		}
+		result = append(result, av)
+	}
+	return result
+}
+
+func (b *apiDocBuilder) funcs(funcs []*doc.Func) []apiFunc {
+	var result []apiFunc
+	for _, f := range funcs {
+		result = append(result, apiFunc{
+			Name:       f.Name,
+			Recv:       f.Recv,
+			Decl:       b.code(f.Decl),
+			Pos:        b.pos(f.Pos),
+			Doc:        f.Doc,
+			Deprecated: f.Deprecated,
+			Examples:   b.examples(f.Examples),
+		})
+	}
+	return result
+}
+
+func (b *apiDocBuilder) types(types []*doc.Type) []apiType {
+	var result []apiType
+	for _, t := range types {
+		at := apiType{
+			Name:        t.Name,
+			Decl:        b.code(t.Decl),
+			Pos:         b.pos(t.Pos),
+			Doc:         t.Doc,
+			Deprecated:  t.Deprecated,
+			IsInterface: t.IsInterface,
+			Consts:      b.values(t.Consts),
+			Vars:        b.values(t.Vars),
+			Funcs:       b.funcs(t.Funcs),
+			Methods:     b.funcs(t.Methods),
+			Examples:    b.examples(t.Examples),
+		}
+		for _, f := range t.Fields {
+			at.Fields = append(at.Fields, apiField{
+				Name:       f.Name,
+				Type:       f.Type.Text,
+				Tag:        f.Tag,
+				Doc:        f.Doc,
+				Deprecated: f.Deprecated,
+				Embedded:   f.Embedded,
+			})
+		}
+		result = append(result, at)
+	}
+	return result
+}
+
+func apiFiles(files []*doc.File) []apiFile {
+	var result []apiFile
+	for _, f := range files {
+		result = append(result, apiFile{Name: f.Name, URL: f.URL})
+	}
+	return result
+}
+
+// newAPIDoc returns the API representation of the documentation for a
+// package, command or directory.
+func newAPIDoc(pdoc *doc.Package, pkgs []database.Package) *apiDoc {
+	b := &apiDocBuilder{pdoc: pdoc}
+	d := &apiDoc{
+		ImportPath:     pdoc.ImportPath,
+		Name:           pdoc.Name,
+		IsCommand:      pdoc.IsCmd,
+		Synopsis:       pdoc.Synopsis,
+		Doc:            pdoc.Doc,
+		Deprecated:     pdoc.Deprecated,
+		ProjectRoot:    pdoc.ProjectRoot,
+		ProjectName:    pdoc.ProjectName,
+		ProjectURL:     pdoc.ProjectURL,
+		VCS:            pdoc.VCS,
+		BrowseURL:      pdoc.BrowseURL,
+		Updated:        pdoc.Updated,
+		Truncated:      pdoc.Truncated,
+		GOOS:           pdoc.GOOS,
+		GOARCH:         pdoc.GOARCH,
+		Errors:         pdoc.Errors,
+		Consts:         b.values(pdoc.Consts),
+		Vars:           b.values(pdoc.Vars),
+		Funcs:          b.funcs(pdoc.Funcs),
+		Types:          b.types(pdoc.Types),
+		Examples:       b.examples(pdoc.Examples),
+		Files:          apiFiles(pdoc.Files),
+		TestFiles:      apiFiles(pdoc.TestFiles),
+		Imports:        pdoc.Imports,
+		TestImports:    pdoc.TestImports,
+		XTestImports:   pdoc.XTestImports,
+		Subdirectories: pkgs,
+	}
+	for _, f := range pdoc.Flags {
+		d.Flags = append(d.Flags, apiFlag{
+			Name:    f.Name,
+			Type:    f.Type,
+			Default: f.Default,
+			Usage:   f.Usage,
+			Pos:     b.pos(f.Pos),
+		})
+	}
+	if len(pdoc.Notes) > 0 {
+		d.Notes = make(map[string][]apiNote)
+		for marker, notes := range pdoc.Notes {
+			for _, n := range notes {
+				d.Notes[marker] = append(d.Notes[marker], apiNote{UID: n.UID, Body: n.Body, Pos: b.pos(n.Pos)})
+			}
+		}
+	}
+	if r := pdoc.Readme; r != nil {
+		d.Readme = &apiReadme{Name: r.Name, URL: r.URL, Text: r.Text}
+	}
+	return d
+}
@@ -0,0 +1,60 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/garyburd/gddo/doc"
+)
+
+// TestAPIDoc checks the JSON field names used by API clients.
+func TestAPIDoc(t *testing.T) {
+	pdoc := &doc.Package{
+		ImportPath: "example.com/foo",
+		Name:       "foo",
+		Updated:    time.Date(2013, 1, 2, 3, 4, 5, 0, time.UTC),
+		Files:      []*doc.File{{Name: "foo.go", URL: "http://example.com/foo.go"}},
+		Funcs: []*doc.Func{{
+			Name: "F",
+			Decl: doc.Code{
+				Text:        "func F() io.Reader",
+				Annotations: []doc.Annotation{{Kind: doc.LinkAnnotation, Pos: 10, End: 19, PathIndex: 0}},
+				Paths:       []string{"io"},
+			},
+			Pos: doc.Pos{Line: 7, File: 0},
+			Doc: "F returns a reader.\n",
+		}},
+		Consts: []*doc.Value{{
+			Decl:   doc.Code{Text: "const (\n\tB = iota\n\tA\n)"},
+			Values: []*doc.ConstValue{{Name: "B", Value: "0"}, {Name: "A", Value: "1"}},
+		}},
+		Imports: []string{"io"},
+	}
+	p, err := json.Marshal(newAPIDoc(pdoc, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{"importPath":"example.com/foo","name":"foo","updated":"2013-01-02T03:04:05Z",` +
+		`"consts":[{"decl":{"text":"const (\n\tB = iota\n\tA\n)"},"values":[{"name":"B","value":"0"},{"name":"A","value":"1"}]}],` +
+		`"funcs":[{"name":"F","decl":{"text":"func F() io.Reader","annotations":[{"kind":"link","pos":10,"end":19,"path":"io"}]},` +
+		`"pos":{"file":"foo.go","line":7,"lines":1},"doc":"F returns a reader.\n"}],` +
+		`"files":[{"name":"foo.go","url":"http://example.com/foo.go"}],"imports":["io"]}`
+	if string(p) != expected {
+		t.Errorf("newAPIDoc\n got %s\nwant %s", p, expected)
+	}
+}
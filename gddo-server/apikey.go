@@ -0,0 +1,141 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// This file implements API request quotas. Clients identify themselves with
+// an API key issued by gddo-admin. Clients without a key share a quota per
+// host. Quotas are enforced with the decaying request counters used to
+// detect robots.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/garyburd/indigo/web"
+)
+
+var apiQuota = flag.Float64("api_quota", 200, "Request counter threshold for API clients without a key.")
+
+const (
+	headerAPIKey             = "X-Api-Key"
+	headerRateLimitLimit     = "X-Ratelimit-Limit"
+	headerRateLimitRemaining = "X-Ratelimit-Remaining"
+	headerVary               = "Vary"
+
+	// The web package does not define a constant for this status.
+	statusTooManyRequests = 429
+)
+
+// quotaResponse adds the rate limit headers to the response.
+type quotaResponse struct {
+	web.Response
+	limit, remaining string
+}
+
+func (resp *quotaResponse) Start(status int, header web.Header) io.Writer {
+	if header == nil {
+		header = make(web.Header)
+	}
+	header.Set(headerRateLimitLimit, resp.limit)
+	header.Set(headerRateLimitRemaining, resp.remaining)
+	return resp.Response.Start(status, header)
+}
+
+// apiQuotaHandler returns a handler that counts the requests from each API
+// client and rejects requests from clients over quota.
+func apiQuotaHandler(h web.Handler) web.Handler {
+	return web.HandlerFunc(func(resp web.Response, req *web.Request) error {
+		counter := "api:" + remoteHost(req)
+		quota := *apiQuota
+
+		key := req.Header.Get(headerAPIKey)
+		if key == "" {
+			key = req.URL.Query().Get("key")
+		}
+		if key != "" {
+			k, err := db.GetAPIKey(key)
+			if err != nil {
+				log.Printf("ERROR db.GetAPIKey: %v", err)
+				writeAPIError(resp, web.StatusInternalServerError, apiErrorInfo{"internal_error", web.StatusText(web.StatusInternalServerError)})
+				return nil
+			}
+			if k == nil {
+				writeAPIError(resp, web.StatusUnauthorized, apiErrorInfo{"invalid_key", "The API key is not valid."})
+				return nil
+			}
+			counter = "apikey:" + k.Key
+			quota = k.Quota
+		}
+
+		n, err := db.IncrementCounter(counter, 1)
+		if err != nil {
+			// Do not reject requests when the counter is not available.
+			log.Printf("error incrementing counter for %s, %v", counter, err)
+			return h.ServeWeb(resp, req)
+		}
+
+		qresp := &quotaResponse{
+			Response:  resp,
+			limit:     strconv.FormatFloat(quota, 'f', 0, 64),
+			remaining: strconv.FormatFloat(math.Max(0, math.Floor(quota-n)), 'f', 0, 64),
+		}
+		if n > quota {
+			writeAPIError(qresp, statusTooManyRequests, apiErrorInfo{"quota_exceeded", "The request quota for the client is exceeded."})
+			return nil
+		}
+		return h.ServeWeb(qresp, req)
+	})
+}
+
+// varyAcceptResponse adds the Vary header to responses that depend on the
+// Accept request header.
+type varyAcceptResponse struct {
+	web.Response
+}
+
+func (resp varyAcceptResponse) Start(status int, header web.Header) io.Writer {
+	if header == nil {
+		header = make(web.Header)
+	}
+	header.Set(headerVary, "Accept")
+	return resp.Response.Start(status, header)
+}
+
+// negotiatedHandler returns a handler for pages that are also served as JSON.
+// JSON requests are subject to the API quotas.
+func negotiatedHandler(h web.Handler) web.Handler {
+	quotaHandler := apiQuotaHandler(h)
+	return web.HandlerFunc(func(resp web.Response, req *web.Request) error {
+		resp = varyAcceptResponse{resp}
+		if acceptsJSON(req) {
+			return quotaHandler.ServeWeb(resp, req)
+		}
+		return h.ServeWeb(resp, req)
+	})
+}
+
+// writeAPIError writes an API error response.
+func writeAPIError(resp web.Response, status int, info apiErrorInfo) {
+	var data struct {
+		Error apiErrorInfo `json:"error"`
+	}
+	data.Error = info
+	w := resp.Start(status, web.Header{web.HeaderContentType: {"application/json; charset=utf-8"}})
+	json.NewEncoder(w).Encode(&data)
+}
@@ -1,6 +1,32 @@
 $(function() {
     var prevCh = null, prevTime = 0, modal = false;
 
+    // symbols returns the anchors for the identifiers on a package page.
+    function symbols() {
+        var result = [];
+        $('h3[id], h4[id], pre span[id]').each(function() {
+            var id = $(this).attr('id');
+            if (id.substring(0, 4) != 'pkg-') {
+                result.push(id);
+            }
+        });
+        return result;
+    }
+
+    function jump(id) {
+        $('#x-jump').modal('hide');
+        window.location.hash = id;
+    }
+
+    $('#x-jump-text').on('typeahead:selected', function(e, datum) {
+        jump(datum.value);
+    });
+
+    $('#x-jump-form').on('submit', function() {
+        jump($('#x-jump-text').val());
+        return false;
+    });
+
     $('.modal').on({
         show: function() { modal = true; },
         hidden: function() { modal = false; }
@@ -98,4 +124,35 @@ $(function() {
         $(e.target).select();
     });
 
+    // Client-side search for sites created with the -export flag.
+    var staticSearch = $('#x-static-search');
+    if (staticSearch.length) {
+        $.getJSON(staticSearch.attr('data-index'), function(pkgs) {
+            function search() {
+                var terms = $.trim(staticSearch.val().toLowerCase()).split(/\s+/);
+                var results = $('#x-static-results').empty();
+                if (terms[0] == '') {
+                    return;
+                }
+                $.each(pkgs, function(i, pkg) {
+                    var text = (pkg.path + ' ' + (pkg.synopsis || '')).toLowerCase();
+                    for (var j = 0; j < terms.length; j++) {
+                        if (text.indexOf(terms[j]) < 0) {
+                            return;
+                        }
+                    }
+                    results.append($('<tr>').append(
+                        $('<td>').append($('<a>').attr('href', pkg.path + '/index.html').text(pkg.path)),
+                        $('<td class="synopsis">').text(pkg.synopsis || '')));
+                });
+            }
+            var m = /[?&]q=([^&]*)/.exec(window.location.search);
+            if (m) {
+                staticSearch.val(decodeURIComponent(m[1].replace(/\+/g, ' ')));
+            }
+            staticSearch.on('input', search);
+            search();
+        });
+    }
+
 });
@@ -16,11 +16,16 @@ package main
 
 import (
 	"flag"
-	"github.com/garyburd/gosrc"
 	"log"
 	"time"
 )
 
+var githubInterval = flag.Duration("github_interval", 0, "Github updates crawler sleeps for this duration between fetches. Zero disables the crawler.")
+
+var crawlWorkers = flag.Int("crawl_workers", 0, "Number of concurrent crawl workers. Zero disables the concurrent crawler.")
+
+var crawlInterval = flag.Duration("crawl_interval", 0, "Package updater sleeps for this duration between package updates. Zero disables updates.")
+
 var backgroundTasks = []*struct {
 	name     string
 	fn       func() error
@@ -30,12 +35,17 @@ var backgroundTasks = []*struct {
 	{
 		name:     "GitHub updates",
 		fn:       readGitHubUpdates,
-		interval: flag.Duration("github_interval", 0, "Github updates crawler sleeps for this duration between fetches. Zero disables the crawler."),
+		interval: githubInterval,
 	},
 	{
 		name:     "Crawl",
 		fn:       doCrawl,
-		interval: flag.Duration("crawl_interval", 0, "Package updater sleeps for this duration between package updates. Zero disables updates."),
+		interval: crawlInterval,
+	},
+	{
+		name:     "Block expiration",
+		fn:       expireBlocks,
+		interval: flag.Duration("block_interval", time.Hour, "Expired blocks are lifted at this interval. Zero disables expiration."),
 	},
 }
 
@@ -71,11 +81,8 @@ func doCrawl() error {
 		return nil
 	}
 	if importPath != "" {
-		if pdoc, err := crawlDoc("new", importPath, nil, hasSubdirs, time.Time{}); pdoc == nil && err == nil {
-			if err := db.AddBadCrawl(importPath); err != nil {
-				log.Printf("ERROR db.AddBadCrawl(%q): %v", importPath, err)
-			}
-		}
+		// Failed crawls are recorded by crawlDoc.
+		crawlDoc("new", importPath, nil, hasSubdirs, time.Time{})
 		return nil
 	}
 
@@ -88,35 +95,19 @@ func doCrawl() error {
 	if pdoc == nil || nextCrawl.After(time.Now()) {
 		return nil
 	}
-	if _, err = crawlDoc("crawl", pdoc.ImportPath, pdoc, len(pkgs) > 0, nextCrawl); err != nil {
-		// Touch package so that crawl advances to next package.
-		if err := db.SetNextCrawlEtag(pdoc.ProjectRoot, pdoc.Etag, time.Now().Add(*maxAge/3)); err != nil {
-			log.Printf("ERROR db.TouchLastCrawl(%q): %v", pdoc.ImportPath, err)
-		}
-	}
+	// Failed crawls are rescheduled with backoff by crawlDoc.
+	crawlDoc("crawl", pdoc.ImportPath, pdoc, len(pkgs) > 0, nextCrawl)
 	return nil
 }
 
-func readGitHubUpdates() error {
-	const key = "gitHubUpdates"
-	var last string
-	if err := db.GetGob(key, &last); err != nil {
-		return err
-	}
-	last, names, err := gosrc.GetGitHubUpdates(httpClient, last)
-	if err != nil {
-		return err
-	}
-
-	for _, name := range names {
-		log.Printf("bump crawl github.com/%s", name)
-		if err := db.BumpCrawl("github.com/" + name); err != nil {
-			log.Println("ERROR force crawl:", err)
-		}
+func expireBlocks() error {
+	roots, err := db.ExpireBlocks(time.Now())
+	for _, root := range roots {
+		log.Printf("Block expired %s", root)
 	}
+	return err
+}
 
-	if err := db.PutGob(key, last); err != nil {
-		return err
-	}
-	return nil
+func readGitHubUpdates() error {
+	return docCrawler.ReadGitHubUpdates(3 * *githubInterval)
 }
@@ -0,0 +1,585 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// This file implements parsing of Go doc comments. A parsed comment is
+// rendered as HTML by the HTML templates and as text by the text templates.
+//
+// The supported syntax is paragraphs, headings ("# Heading" and the older
+// single line form), indented code blocks, indented lists, URLs, doc links
+// ([Name], [pkg.Name], [Type.Method], [path/to/pkg.Name]) and links to
+// definitions of the form "[Text]: URL".
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htemp "html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/garyburd/gosrc"
+)
+
+type commentBlockKind int
+
+const (
+	commentParagraph commentBlockKind = iota
+	commentHeading
+	commentCode
+	commentList
+)
+
+type commentBlock struct {
+	kind     commentBlockKind
+	text     string   // paragraph or heading text
+	lines    []string // code lines
+	items    []string // list item text
+	numbered bool     // list is numbered
+	loose    bool     // list items are separated by blank lines
+}
+
+type comment struct {
+	blocks    []*commentBlock
+	links     map[string]string // link definitions
+	linkNames []string          // link definition names in order seen
+}
+
+var (
+	commentLinkDefPat  = regexp.MustCompile(`^\[([^\[\]]+)\]:\s+(\S+)$`)
+	commentListItemPat = regexp.MustCompile(`^(?:[-*+•]|(\d+)[.)])\s+`)
+	urlPat             = regexp.MustCompile(`^https?://[^\s<>"'()]*[^\s<>"'().,:;!?]`)
+)
+
+// safeURLSchemes is the set of schemes allowed in links from doc comments
+// and READMEs.
+var safeURLSchemes = map[string]bool{"http": true, "https": true, "ftp": true, "mailto": true}
+
+// parseComment parses the text of a doc comment.
+func parseComment(text string) *comment {
+	c := &comment{links: make(map[string]string)}
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	for len(lines) > 0 {
+		switch {
+		case isBlank(lines[0]):
+			lines = lines[1:]
+		case indent(lines[0]) == 0:
+			n := 1
+			for n < len(lines) && !isBlank(lines[n]) && indent(lines[n]) == 0 {
+				n++
+			}
+			c.textSpan(lines[:n], n < len(lines) && isBlank(lines[n]) && nextTextSpan(lines[n:]))
+			lines = lines[n:]
+		default:
+			n := 0
+			for i := 0; i < len(lines) && (isBlank(lines[i]) || indent(lines[i]) > 0); i++ {
+				if !isBlank(lines[i]) {
+					n = i + 1
+				}
+			}
+			c.indentedSpan(lines[:n])
+			lines = lines[n:]
+		}
+	}
+	return c
+}
+
+// isSafeCommentURL returns true if s is an absolute URL with a scheme that
+// is safe to use in a link.
+func isSafeCommentURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && safeURLSchemes[u.Scheme]
+}
+
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
+// indent returns the width of the leading white space in s.
+func indent(s string) int {
+	n := 0
+	for _, r := range s {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// unindent removes up to n columns of leading white space from each line.
+func unindent(lines []string, n int) []string {
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		j := 0
+		for w := 0; j < len(line) && w < n; j++ {
+			switch line[j] {
+			case ' ':
+				w++
+			case '\t':
+				w += 4 - w%4
+			default:
+				w = n
+				j--
+			}
+		}
+		result[i] = line[j:]
+	}
+	return result
+}
+
+// nextTextSpan returns true if the first non-blank line is not indented.
+func nextTextSpan(lines []string) bool {
+	for _, line := range lines {
+		if !isBlank(line) {
+			return indent(line) == 0
+		}
+	}
+	return false
+}
+
+func (c *comment) textSpan(lines []string, beforeParagraph bool) {
+	if len(lines) == 1 && strings.HasPrefix(lines[0], "# ") {
+		c.blocks = append(c.blocks, &commentBlock{kind: commentHeading, text: strings.TrimSpace(lines[0][2:])})
+		return
+	}
+
+	isLinkDefs := true
+	for _, line := range lines {
+		if !commentLinkDefPat.MatchString(line) {
+			isLinkDefs = false
+			break
+		}
+	}
+	if isLinkDefs {
+		// Definitions with unsafe URLs are shown as plain text.
+		var unsafe []string
+		for _, line := range lines {
+			m := commentLinkDefPat.FindStringSubmatch(line)
+			if !isSafeCommentURL(m[2]) {
+				unsafe = append(unsafe, line)
+				continue
+			}
+			if _, ok := c.links[m[1]]; !ok {
+				c.links[m[1]] = m[2]
+				c.linkNames = append(c.linkNames, m[1])
+			}
+		}
+		if len(unsafe) > 0 {
+			c.blocks = append(c.blocks, &commentBlock{kind: commentParagraph, text: strings.Join(unsafe, "\n")})
+		}
+		return
+	}
+
+	// A single line preceded and followed by a paragraph is a heading.
+	if len(lines) == 1 && beforeParagraph && len(c.blocks) > 0 &&
+		c.blocks[len(c.blocks)-1].kind == commentParagraph && isCommentHeading(lines[0]) {
+		c.blocks = append(c.blocks, &commentBlock{kind: commentHeading, text: lines[0]})
+		return
+	}
+
+	c.blocks = append(c.blocks, &commentBlock{kind: commentParagraph, text: strings.Join(lines, "\n")})
+}
+
+func (c *comment) indentedSpan(lines []string) {
+	n := -1
+	for _, line := range lines {
+		if !isBlank(line) && (n < 0 || indent(line) < n) {
+			n = indent(line)
+		}
+	}
+	lines = unindent(lines, n)
+
+	m := commentListItemPat.FindStringSubmatch(lines[0])
+	if m == nil {
+		c.blocks = append(c.blocks, &commentBlock{kind: commentCode, lines: lines})
+		return
+	}
+
+	b := &commentBlock{kind: commentList, numbered: m[1] != ""}
+	blank := false
+	for _, line := range lines {
+		switch {
+		case isBlank(line):
+			blank = true
+		case commentListItemPat.MatchString(line):
+			if blank {
+				b.loose = true
+			}
+			blank = false
+			b.items = append(b.items, line[len(commentListItemPat.FindString(line)):])
+		default:
+			blank = false
+			b.items[len(b.items)-1] += "\n" + strings.TrimSpace(line)
+		}
+	}
+	c.blocks = append(c.blocks, b)
+}
+
+// isCommentHeading returns true if line has the form of a heading in the
+// older heading syntax.
+func isCommentHeading(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(line)
+	if !unicode.IsLetter(r) || !unicode.IsUpper(r) {
+		return false
+	}
+	r, _ = utf8.DecodeLastRuneInString(line)
+	if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+		return false
+	}
+	if strings.ContainsAny(line, ";:!?+*/=()[]{}_^°&§~%#@<\">\\") {
+		return false
+	}
+	// Allow "'" only when followed by "s" at the end of a word.
+	for s := line; ; {
+		i := strings.IndexRune(s, '\'')
+		if i < 0 {
+			break
+		}
+		if i+1 >= len(s) || s[i+1] != 's' || (i+2 < len(s) && s[i+2] != ' ') {
+			return false
+		}
+		s = s[i+2:]
+	}
+	// Allow "." only when followed by a non-space character.
+	for s := line; ; {
+		i := strings.IndexRune(s, '.')
+		if i < 0 {
+			break
+		}
+		if i+1 >= len(s) || s[i+1] == ' ' {
+			return false
+		}
+		s = s[i+1:]
+	}
+	return true
+}
+
+// commentSpan is a span of text in a paragraph, heading or list item.
+type commentSpan struct {
+	text   string
+	url    string // link URL or "" for plain text
+	isDef  bool   // link to a link definition
+	isText bool   // plain text
+}
+
+// isLinkBoundary returns true if the rune r can precede or follow a link.
+func isLinkBoundary(r rune) bool {
+	return r == utf8.RuneError || unicode.IsSpace(r) || unicode.IsPunct(r)
+}
+
+// spans splits s into plain text and links. The function resolve returns
+// the URL for a doc link or "" if the link cannot be resolved.
+func (c *comment) spans(s string, resolve func(string) string) []commentSpan {
+	var spans []commentSpan
+	text := func(t string) {
+		if n := len(spans); n > 0 && spans[n-1].isText {
+			spans[n-1].text += t
+		} else if t != "" {
+			spans = append(spans, commentSpan{text: t, isText: true})
+		}
+	}
+	start := 0
+	for i := 0; i < len(s); {
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		if i > 0 && !isLinkBoundary(before) {
+			i++
+			continue
+		}
+		if s[i] == '[' {
+			if j := strings.IndexAny(s[i+1:], "[]"); j >= 0 && s[i+1+j] == ']' {
+				t := s[i+1 : i+1+j]
+				end := i + 2 + j
+				after, _ := utf8.DecodeRuneInString(s[end:])
+				if isLinkBoundary(after) && after != '(' {
+					if u, ok := c.links[t]; ok {
+						text(s[start:i])
+						spans = append(spans, commentSpan{text: t, url: u, isDef: true})
+						i, start = end, end
+						continue
+					}
+					if u := resolve(t); u != "" {
+						text(s[start:i])
+						spans = append(spans, commentSpan{text: strings.TrimPrefix(t, "*"), url: u})
+						i, start = end, end
+						continue
+					}
+				}
+			}
+		} else if m := urlPat.FindString(s[i:]); m != "" {
+			text(s[start:i])
+			spans = append(spans, commentSpan{text: m, url: m})
+			i += len(m)
+			start = i
+			continue
+		}
+		i++
+	}
+	text(s[start:])
+	return spans
+}
+
+// commentHeadingID returns the id for a heading. The id matches the id
+// generated by the go/doc package.
+func commentHeadingID(text string) string {
+	id := []rune("hdr-")
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			id = append(id, r)
+		} else {
+			id = append(id, '_')
+		}
+	}
+	return string(id)
+}
+
+// htmlQuoteReplacer converts quotes in HTML escaped text. HTMLEscapeString
+// escapes ' as &#39;.
+var htmlQuoteReplacer = strings.NewReplacer("``", "&ldquo;", "&#39;&#39;", "&rdquo;")
+
+// escapeCommentText escapes plain text and links RFC references and
+// package paths.
+func escapeCommentText(buf *bytes.Buffer, s string) {
+	p := []byte(htmlQuoteReplacer.Replace(htemp.HTMLEscapeString(s)))
+	p = replaceAll(p, rfcPat, func(out, src []byte, m []int) []byte {
+		out = append(out, `<a href="http://tools.ietf.org/html/rfc`...)
+		out = append(out, src[m[2]:m[3]]...)
+		out = append(out, `">`...)
+		out = append(out, src[m[0]:m[1]]...)
+		out = append(out, `</a>`...)
+		return out
+	})
+	p = replaceAll(p, packagePat, func(out, src []byte, m []int) []byte {
+		path := bytes.TrimRight(src[m[2]:m[3]], ".!?:")
+		if !gosrc.IsValidPath(string(path)) {
+			return append(out, src[m[0]:m[1]]...)
+		}
+		out = append(out, src[m[0]:m[2]]...)
+		out = append(out, `<a href="/`...)
+		out = append(out, path...)
+		out = append(out, `">`...)
+		out = append(out, path...)
+		out = append(out, `</a>`...)
+		out = append(out, src[m[2]+len(path):m[1]]...)
+		return out
+	})
+	buf.Write(p)
+}
+
+func (c *comment) inlineHTML(buf *bytes.Buffer, s string, resolve func(string) string) {
+	for _, span := range c.spans(s, resolve) {
+		if span.url == "" {
+			escapeCommentText(buf, span.text)
+			continue
+		}
+		buf.WriteString(`<a href="`)
+		buf.WriteString(htemp.HTMLEscapeString(span.url))
+		buf.WriteString(`">`)
+		buf.WriteString(htemp.HTMLEscapeString(span.text))
+		buf.WriteString(`</a>`)
+	}
+}
+
+// HTML returns the comment formatted as HTML.
+func (c *comment) HTML(resolve func(string) string) htemp.HTML {
+	var buf bytes.Buffer
+	for _, b := range c.blocks {
+		switch b.kind {
+		case commentParagraph:
+			buf.WriteString("<p>\n")
+			c.inlineHTML(&buf, b.text, resolve)
+			buf.WriteString("\n</p>\n")
+		case commentHeading:
+			id := htemp.HTMLEscapeString(commentHeadingID(b.text))
+			buf.WriteString(`<h4 id="` + id + `">`)
+			c.inlineHTML(&buf, b.text, resolve)
+			buf.WriteString(` <a class="permalink" href="#` + id + `">&para;</a></h4>` + "\n")
+		case commentCode:
+			buf.WriteString("<pre>")
+			buf.WriteString(htemp.HTMLEscapeString(strings.Join(b.lines, "\n")))
+			buf.WriteString("</pre>\n")
+		case commentList:
+			tag := "ul"
+			if b.numbered {
+				tag = "ol"
+			}
+			buf.WriteString("<" + tag + ">\n")
+			for _, item := range b.items {
+				buf.WriteString("<li>")
+				if b.loose {
+					buf.WriteString("<p>")
+				}
+				c.inlineHTML(&buf, item, resolve)
+				if b.loose {
+					buf.WriteString("</p>")
+				}
+				buf.WriteString("</li>\n")
+			}
+			buf.WriteString("</" + tag + ">\n")
+		}
+	}
+	return htemp.HTML(buf.String())
+}
+
+func (c *comment) inlineText(s string, resolve func(string) string) string {
+	var buf bytes.Buffer
+	for _, span := range c.spans(s, resolve) {
+		if span.isDef {
+			buf.WriteString("[" + span.text + "]")
+		} else {
+			buf.WriteString(span.text)
+		}
+	}
+	return buf.String()
+}
+
+// wrapText writes the words in s to buf as lines of at most width
+// characters. The first line is prefixed with first and the following lines
+// are prefixed with rest.
+func wrapText(buf *bytes.Buffer, s, first, rest string, width int) {
+	prefix := first
+	n := 0
+	for _, word := range strings.Fields(s) {
+		if n > 0 && n+1+utf8.RuneCountInString(word) > width {
+			buf.WriteByte('\n')
+			prefix = rest
+			n = 0
+		}
+		if n == 0 {
+			buf.WriteString(prefix)
+		} else {
+			buf.WriteByte(' ')
+			n++
+		}
+		buf.WriteString(word)
+		n += utf8.RuneCountInString(word)
+	}
+	if n > 0 {
+		buf.WriteByte('\n')
+	}
+}
+
+// Text returns the comment formatted as text. Lines are prefixed with
+// indent and wrapped at width. Code is prefixed with indent and codeIndent.
+func (c *comment) Text(resolve func(string) string, indent, codeIndent string, width int) string {
+	var buf bytes.Buffer
+	for i, b := range c.blocks {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		switch b.kind {
+		case commentParagraph, commentHeading:
+			wrapText(&buf, c.inlineText(b.text, resolve), indent, indent, width)
+		case commentCode:
+			for _, line := range b.lines {
+				if line != "" {
+					buf.WriteString(indent + codeIndent + line)
+				}
+				buf.WriteByte('\n')
+			}
+		case commentList:
+			for j, item := range b.items {
+				if b.loose && j > 0 {
+					buf.WriteByte('\n')
+				}
+				marker := "  - "
+				if b.numbered {
+					marker = fmt.Sprintf("%2d. ", j+1)
+				}
+				wrapText(&buf, c.inlineText(item, resolve), indent+marker, indent+"    ", width-4)
+			}
+		}
+	}
+	if len(c.linkNames) > 0 {
+		if len(c.blocks) > 0 {
+			buf.WriteByte('\n')
+		}
+		for _, name := range c.linkNames {
+			buf.WriteString(indent + "[" + name + "]: " + c.links[name] + "\n")
+		}
+	}
+	return buf.String()
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `&lt;`, `>`, `&gt;`, `&`, `&amp;`, `|`, `\|`)
+
+// markdownEscape escapes the Markdown special characters in s.
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+func (c *comment) inlineMarkdown(buf *bytes.Buffer, s string, resolve func(string) string) {
+	for _, span := range c.spans(s, resolve) {
+		if span.url == "" {
+			buf.WriteString(markdownEscape(strings.Replace(span.text, "\n", " ", -1)))
+			continue
+		}
+		buf.WriteString("[" + markdownEscape(span.text) + "](" + strings.Replace(span.url, ")", "%29", -1) + ")")
+	}
+}
+
+// Markdown returns the comment formatted as Markdown. Headings are level
+// four headings and code is formatted as fenced code blocks.
+func (c *comment) Markdown(resolve func(string) string) string {
+	var buf bytes.Buffer
+	for i, b := range c.blocks {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		switch b.kind {
+		case commentParagraph:
+			c.inlineMarkdown(&buf, b.text, resolve)
+			buf.WriteByte('\n')
+		case commentHeading:
+			buf.WriteString("#### ")
+			c.inlineMarkdown(&buf, b.text, resolve)
+			buf.WriteByte('\n')
+		case commentCode:
+			buf.WriteString("```\n")
+			for _, line := range b.lines {
+				buf.WriteString(line + "\n")
+			}
+			buf.WriteString("```\n")
+		case commentList:
+			for j, item := range b.items {
+				if b.loose && j > 0 {
+					buf.WriteByte('\n')
+				}
+				if b.numbered {
+					fmt.Fprintf(&buf, "%d. ", j+1)
+				} else {
+					buf.WriteString("- ")
+				}
+				c.inlineMarkdown(&buf, item, resolve)
+				buf.WriteByte('\n')
+			}
+		}
+	}
+	return buf.String()
+}
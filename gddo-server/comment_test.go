@@ -0,0 +1,96 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/garyburd/gddo/doc"
+)
+
+var commentTestDoc = &tdoc{Package: &doc.Package{
+	ImportPath: "example.com/foo",
+	Name:       "foo",
+	Imports:    []string{"io"},
+	Funcs:      []*doc.Func{{Name: "F"}},
+	Types:      []*doc.Type{{Name: "T", Methods: []*doc.Func{{Name: "M"}}}},
+}}
+
+var commentTests = []struct {
+	in, html, text, markdown string
+}{
+	{
+		"Hello, world.\n",
+		"<p>\nHello, world.\n</p>\n",
+		"    Hello, world.\n",
+		"Hello, world.\n",
+	},
+	{
+		"See [F], [*T], [T.M], [io.Reader], [foo.F] and [not a link].\n",
+		"<p>\nSee <a href=\"#F\">F</a>, <a href=\"#T\">T</a>, <a href=\"#T.M\">T.M</a>, <a href=\"/io#Reader\">io.Reader</a>, <a href=\"#F\">foo.F</a> and [not a link].\n</p>\n",
+		"    See F, T, T.M, io.Reader, foo.F and [not a link].\n",
+		"See [F](#F), [T](#T), [T.M](#T.M), [io.Reader](http://example.com/io#Reader), [foo.F](#F) and \\[not a link\\].\n",
+	},
+	{
+		"Read the [spec] or http://example.com/x.\n\n[spec]: https://go.dev/ref/spec\n",
+		"<p>\nRead the <a href=\"https://go.dev/ref/spec\">spec</a> or <a href=\"http://example.com/x\">http://example.com/x</a>.\n</p>\n",
+		"    Read the [spec] or http://example.com/x.\n\n    [spec]: https://go.dev/ref/spec\n",
+		"Read the [spec](https://go.dev/ref/spec) or [http://example.com/x](http://example.com/x).\n",
+	},
+	{
+		"See [run this].\n\n[run this]: javascript:alert(1)\n",
+		"<p>\nSee [run this].\n</p>\n<p>\n[run this]: javascript:alert(1)\n</p>\n",
+		"    See [run this].\n\n    [run this]: javascript:alert(1)\n",
+		"See \\[run this\\].\n\n\\[run this\\]: javascript:alert(1)\n",
+	},
+	{
+		"Intro.\n\nOld Heading\n\nText.\n\n# New Heading\n",
+		"<p>\nIntro.\n</p>\n<h4 id=\"hdr-Old_Heading\">Old Heading <a class=\"permalink\" href=\"#hdr-Old_Heading\">&para;</a></h4>\n<p>\nText.\n</p>\n<h4 id=\"hdr-New_Heading\">New Heading <a class=\"permalink\" href=\"#hdr-New_Heading\">&para;</a></h4>\n",
+		"    Intro.\n\n    Old Heading\n\n    Text.\n\n    New Heading\n",
+		"Intro.\n\n#### Old Heading\n\nText.\n\n#### New Heading\n",
+	},
+	{
+		"List:\n  - one\n  - two\n    continued\n\nSteps:\n\n  1. first\n\n  2. second\n\nCode:\n\n\tif x < y {\n\t\treturn\n\t}\n",
+		"<p>\nList:\n</p>\n<ul>\n<li>one</li>\n<li>two\ncontinued</li>\n</ul>\n<p>\nSteps:\n</p>\n<ol>\n<li><p>first</p></li>\n<li><p>second</p></li>\n</ol>\n<p>\nCode:\n</p>\n<pre>if x &lt; y {\n\treturn\n}</pre>\n",
+		"    List:\n\n      - one\n      - two continued\n\n    Steps:\n\n     1. first\n\n     2. second\n\n    Code:\n\n    \tif x < y {\n    \t\treturn\n    \t}\n",
+		"List:\n\n- one\n- two continued\n\nSteps:\n\n1. first\n\n2. second\n\nCode:\n\n```\nif x < y {\n\treturn\n}\n```\n",
+	},
+	{
+		"Say ``hi'' to Bob's friend.\n",
+		"<p>\nSay &ldquo;hi&rdquo; to Bob&#39;s friend.\n</p>\n",
+		"    Say ``hi'' to Bob's friend.\n",
+		"Say \\`\\`hi'' to Bob's friend.\n",
+	},
+	{
+		"See RFC 1234 and package example.com/bar.\n",
+		"<p>\nSee <a href=\"http://tools.ietf.org/html/rfc1234\">RFC 1234</a> and package <a href=\"/example.com/bar\">example.com/bar</a>.\n</p>\n",
+		"    See RFC 1234 and package example.com/bar.\n",
+		"See RFC 1234 and package example.com/bar.\n",
+	},
+}
+
+func TestComment(t *testing.T) {
+	for _, tt := range commentTests {
+		if html := string(commentTestDoc.Comment(tt.in)); html != tt.html {
+			t.Errorf("Comment(%q)\n got %q\nwant %q", tt.in, html, tt.html)
+		}
+		if text := commentTestDoc.CommentText(tt.in); text != tt.text {
+			t.Errorf("CommentText(%q)\n got %q\nwant %q", tt.in, text, tt.text)
+		}
+		if markdown := commentTestDoc.CommentMarkdown(tt.in, "http://example.com"); markdown != tt.markdown {
+			t.Errorf("CommentMarkdown(%q)\n got %q\nwant %q", tt.in, markdown, tt.markdown)
+		}
+	}
+}
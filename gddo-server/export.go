@@ -0,0 +1,234 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// This file implements static site export. The documentation pages for a set
+// of packages are rendered to a directory tree of HTML files that can be
+// served by any web server or browsed from the file system.
+
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/garyburd/gddo/database"
+)
+
+var (
+	exportDir    = flag.String("export", "", "Write a static site for the import paths in the command line arguments, or for all packages in the database if there are no arguments, to this directory and exit.")
+	exportOrigin = flag.String("export_origin", "", "Link pages that are not in the static site to this URL, for example http://godoc.org.")
+)
+
+// exportSite writes the static site to dir.
+func exportSite(dir string, importPaths []string) error {
+	if len(importPaths) == 0 {
+		pkgs, err := db.AllPackages()
+		if err != nil {
+			return err
+		}
+		for _, pkg := range pkgs {
+			importPaths = append(importPaths, pkg.Path)
+		}
+	}
+
+	x := &exporter{dir: dir, pages: make(map[string]bool)}
+	for _, importPath := range importPaths {
+		x.pages[importPath] = true
+	}
+
+	for _, f := range []struct {
+		name  string
+		files []string
+	}{
+		{"site.js", siteJSFiles},
+		{"site.css", siteCSSFiles},
+	} {
+		data, err := readFiles(*assetsDir, f.files...)
+		if err != nil {
+			return err
+		}
+		h := md5.New()
+		h.Write(data)
+		cacheBusters[f.name] = fmt.Sprintf("%x", h.Sum(nil))
+		if err := x.writeFile("-/"+f.name, data); err != nil {
+			return err
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(*assetsDir, "favicon.ico"))
+	if err != nil {
+		return err
+	}
+	if err := x.writeFile("favicon.ico", data); err != nil {
+		return err
+	}
+
+	var index []database.Package
+	for _, importPath := range importPaths {
+		pdoc, pkgs, _, err := db.Get(importPath)
+		if err != nil {
+			return err
+		}
+		if pdoc == nil {
+			log.Printf("Export %s: not found", importPath)
+			delete(x.pages, importPath)
+			continue
+		}
+		importerCount, err := db.ImporterCount(importPath)
+		if err != nil {
+			return err
+		}
+		template, data, err := packageTemplateData(pdoc, pkgs, importerCount)
+		if err != nil {
+			return err
+		}
+		if err := x.writePage(importPath, template+".html", data); err != nil {
+			return err
+		}
+		if pdoc.Name != "" {
+			index = append(index, database.Package{Path: pdoc.ImportPath, Synopsis: pdoc.Synopsis})
+		}
+	}
+
+	pkgs, err := db.GoIndex()
+	if err != nil {
+		return err
+	}
+	if err := x.writePage("-/go", "std.html", map[string]interface{}{"pkgs": pkgs}); err != nil {
+		return err
+	}
+
+	p, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := x.writeFile("-/search.json", p); err != nil {
+		return err
+	}
+
+	popular, err := popular()
+	if err != nil {
+		return err
+	}
+	var exported []database.Package
+	for _, pkg := range popular {
+		if x.pages[pkg.Path] {
+			exported = append(exported, pkg)
+		}
+	}
+	return x.writePage("", "home.html", map[string]interface{}{"Popular": exported, "static": true})
+}
+
+type exporter struct {
+	dir string
+
+	// pages is the set of import paths in the static site.
+	pages map[string]bool
+}
+
+func (x *exporter) writeFile(name string, data []byte) error {
+	fname := filepath.Join(x.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fname), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fname, data, 0666)
+}
+
+// writePage executes the template and writes the result to index.html in the
+// directory for the page with the given path.
+func (x *exporter) writePage(page, template string, data interface{}) error {
+	t := templates[template]
+	if t == nil {
+		return fmt.Errorf("Template %s not found", template)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return err
+	}
+	name := "index.html"
+	if page != "" {
+		name = page + "/index.html"
+	}
+	return x.writeFile(name, x.relativeLinks(page, buf.Bytes()))
+}
+
+var linkAttrPat = regexp.MustCompile(`\b(href|src|action|data-index)="([^"]*)"`)
+
+// relativeLinks rewrites the site links in the page with the given path to
+// links relative to the page.
+func (x *exporter) relativeLinks(page string, p []byte) []byte {
+	return linkAttrPat.ReplaceAllFunc(p, func(m []byte) []byte {
+		sm := linkAttrPat.FindSubmatch(m)
+		return []byte(fmt.Sprintf(`%s="%s"`, sm[1], x.relativeLink(page, string(sm[2]))))
+	})
+}
+
+func (x *exporter) relativeLink(page, link string) string {
+	switch {
+	case strings.HasPrefix(link, "?"):
+		return *exportOrigin + "/" + page + link
+	case !strings.HasPrefix(link, "/") || strings.HasPrefix(link, "//"):
+		return link
+	}
+
+	p, query := link, ""
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p, query = p[:i], p[i:]
+	}
+	p = strings.TrimSuffix(p, "/")
+
+	var target string
+	switch {
+	case p == "":
+		target = "index.html"
+	case strings.HasPrefix(p, "/-/") && staticAssetName(p[len("/-/"):]):
+		target = p[1:]
+	case p == "/favicon.ico":
+		target = p[1:]
+	case p == "/-/go" && !strings.HasPrefix(query, "?"):
+		target = "-/go/index.html"
+	case x.pages[p[1:]] && !strings.HasPrefix(query, "?"):
+		target = p[1:] + "/index.html"
+	default:
+		return *exportOrigin + link
+	}
+
+	if strings.HasPrefix(query, "?") {
+		if i := strings.Index(query, "#"); i >= 0 {
+			query = query[i:]
+		} else {
+			query = ""
+		}
+	}
+
+	depth := 0
+	if page != "" {
+		depth = strings.Count(page, "/") + 1
+	}
+	return strings.Repeat("../", depth) + target + query
+}
+
+// staticAssetName returns true if name is a file written to the -/ directory
+// of the static site.
+func staticAssetName(name string) bool {
+	return name == "site.js" || name == "site.css" || name == "search.json"
+}
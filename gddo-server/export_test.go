@@ -0,0 +1,51 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+var relativeLinkTests = []struct {
+	page, link, expected string
+}{
+	{"", "/", "index.html"},
+	{"", "/-/site.css?v=abc", "-/site.css"},
+	{"", "/a/b", "a/b/index.html"},
+	{"", "/-/go", "-/go/index.html"},
+	{"a/b", "/", "../../index.html"},
+	{"a/b", "/-/site.js?v=abc", "../../-/site.js"},
+	{"a/b", "/a", "../../a/index.html"},
+	{"a/b", "/a#pkg-index", "../../a/index.html#pkg-index"},
+	{"a/b", "/a?imports", "http://example.com/a?imports"},
+	{"a/b", "/c", "http://example.com/c"},
+	{"a/b", "?status.svg", "http://example.com/a/b?status.svg"},
+	{"a/b", "#pkg-index", "#pkg-index"},
+	{"a/b", "//example.org/x", "//example.org/x"},
+	{"a/b", "http://golang.org/", "http://golang.org/"},
+	{"-/go", "/a/b", "../../a/b/index.html"},
+}
+
+func TestRelativeLink(t *testing.T) {
+	defer func(origin string) { *exportOrigin = origin }(*exportOrigin)
+	*exportOrigin = "http://example.com"
+	x := &exporter{pages: map[string]bool{"a": true, "a/b": true}}
+	for _, tt := range relativeLinkTests {
+		actual := x.relativeLink(tt.page, tt.link)
+		if actual != tt.expected {
+			t.Errorf("relativeLink(%q, %q) = %q, want %q", tt.page, tt.link, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// This file implements local mode. In local mode, the server documents the
+// packages in a list of workspaces instead of crawling. The workspaces are
+// polled for changes and packages are rebuilt when files change.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/garyburd/gddo/doc"
+)
+
+var (
+	localPath     = flag.String("local", "", "Serve documentation for the packages in this list of GOPATH workspaces instead of crawling. A workspace without a src directory is the root of the import path tree. Local mode requires a database that is not used for crawled packages. Packages in the database that are not in the workspaces are deleted.")
+	localInterval = flag.Duration("local_interval", 2*time.Second, "Check local workspaces for changes with this interval.")
+)
+
+// localRoots returns the directories at the root of the import path tree in
+// the local workspaces.
+func localRoots() []string {
+	var roots []string
+	for _, p := range filepath.SplitList(*localPath) {
+		if p == "" {
+			continue
+		}
+		if fi, err := os.Stat(filepath.Join(p, "src")); err == nil && fi.IsDir() {
+			p = filepath.Join(p, "src")
+		}
+		roots = append(roots, p)
+	}
+	return roots
+}
+
+// localDirFingerprint returns a string that changes when the Go or README
+// files in the directory change. The empty string is returned if the
+// directory does not contain Go files.
+func localDirFingerprint(fis []os.FileInfo) string {
+	var buf []byte
+	hasGo := false
+	for _, fi := range fis {
+		if fi.IsDir() {
+			if doc.IsLocalSubdir(fi.Name()) {
+				buf = append(buf, fi.Name()...)
+				buf = append(buf, '/', 0)
+			}
+			continue
+		}
+		if strings.HasSuffix(fi.Name(), ".go") {
+			hasGo = true
+		}
+		buf = append(buf, fmt.Sprintf("%s %d %d\x00", fi.Name(), fi.Size(), fi.ModTime().UnixNano())...)
+	}
+	if !hasGo {
+		return ""
+	}
+	return string(buf)
+}
+
+// scanLocal walks the directory tree at dir and records the fingerprint and
+// directory of the packages found in the tree.
+func scanLocal(dir, importPath string, fingerprints map[string]string, dirs map[string]string) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Printf("Local %s: %v", dir, err)
+		return
+	}
+	if importPath != "" {
+		if fp := localDirFingerprint(fis); fp != "" {
+			if _, found := dirs[importPath]; !found {
+				fingerprints[importPath] = fp
+				dirs[importPath] = dir
+			}
+		}
+	}
+	for _, fi := range fis {
+		if fi.IsDir() && doc.IsLocalSubdir(fi.Name()) {
+			p := fi.Name()
+			if importPath != "" {
+				p = importPath + "/" + p
+			}
+			scanLocal(filepath.Join(dir, fi.Name()), p, fingerprints, dirs)
+		}
+	}
+}
+
+// storedLocal returns the packages stored in the database by an earlier run
+// with empty fingerprints so that the first call to updateLocal rebuilds the
+// packages that still exist and deletes the others.
+func storedLocal() map[string]string {
+	paths, err := db.Paths()
+	if err != nil {
+		log.Printf("ERROR db.Paths(): %v", err)
+	}
+	previous := make(map[string]string)
+	for _, p := range paths {
+		previous[p] = ""
+	}
+	return previous
+}
+
+// updateLocal rebuilds the packages that changed since the previous call
+// and removes deleted packages from the database. The previous fingerprint
+// is kept for packages that fail to update so that the update is retried.
+func updateLocal(previous map[string]string) map[string]string {
+	fingerprints := make(map[string]string)
+	dirs := make(map[string]string)
+	for _, root := range localRoots() {
+		scanLocal(root, "", fingerprints, dirs)
+	}
+	for importPath, fp := range fingerprints {
+		if previous[importPath] == fp {
+			continue
+		}
+		pdoc, err := doc.GetLocal(dirs[importPath], importPath)
+		if err != nil {
+			log.Printf("Local %s: %v", importPath, err)
+			fingerprints[importPath] = previous[importPath]
+			continue
+		}
+		if err := db.Put(pdoc, time.Time{}); err != nil {
+			log.Printf("ERROR db.Put(%q): %v", importPath, err)
+			fingerprints[importPath] = previous[importPath]
+			continue
+		}
+		log.Printf("Local put %s", importPath)
+	}
+	for importPath := range previous {
+		if _, found := fingerprints[importPath]; !found {
+			if err := db.Delete(importPath); err != nil {
+				log.Printf("ERROR db.Delete(%q): %v", importPath, err)
+				fingerprints[importPath] = previous[importPath]
+				continue
+			}
+			log.Printf("Local delete %s", importPath)
+		}
+	}
+	return fingerprints
+}
+
+// watchLocal rebuilds local packages as the files in the workspaces change.
+func watchLocal(fingerprints map[string]string) {
+	for {
+		time.Sleep(*localInterval)
+		fingerprints = updateLocal(fingerprints)
+	}
+}
@@ -41,6 +41,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/garyburd/gddo/crawler"
 	"github.com/garyburd/gddo/database"
 	"github.com/garyburd/gddo/doc"
 	"github.com/garyburd/gosrc"
@@ -78,12 +79,14 @@ func getDoc(path string, requestType int) (*doc.Package, []database.Package, err
 	}
 
 	needsCrawl := false
-	switch requestType {
-	case queryRequest:
+	switch {
+	case *localPath != "":
+		// Local packages are updated by watchLocal.
+	case requestType == queryRequest:
 		needsCrawl = nextCrawl.IsZero() && len(pkgs) == 0
-	case humanRequest:
+	case requestType == humanRequest:
 		needsCrawl = nextCrawl.Before(time.Now())
-	case robotRequest:
+	case requestType == robotRequest:
 		needsCrawl = nextCrawl.IsZero() && len(pkgs) > 0
 	}
 
@@ -114,7 +117,7 @@ func getDoc(path string, requestType int) (*doc.Package, []database.Package, err
 			} else if err == errUpdateTimeout {
 				// Handle timeout on packages never seeen before as not found.
 				log.Printf("Serving %q as not found after timeout", path)
-				err = &web.Error{Status: web.StatusNotFound}
+				err = &web.Error{Status: web.StatusNotFound, Reason: errUpdateTimeout}
 			}
 		}
 	}
@@ -128,18 +131,53 @@ func templateExt(req *web.Request) string {
 	return ".html"
 }
 
+// acceptsJSON returns true if the client prefers JSON to HTML.
+func acceptsJSON(req *web.Request) bool {
+	return web.NegotiateContentType(req, []string{"text/html", "application/json"}, "text/html") == "application/json"
+}
+
+// packageTemplateExt returns the extension of the template for a package,
+// command or directory page. These pages are also available as Markdown.
+func packageTemplateExt(req *web.Request) string {
+	if req.Form.Get("format") == "md" {
+		return ".md"
+	}
+	switch web.NegotiateContentType(req, []string{"text/html", "text/plain", "text/markdown"}, "text/html") {
+	case "text/plain":
+		return ".txt"
+	case "text/markdown":
+		return ".md"
+	}
+	return ".html"
+}
+
+// siteOrigin returns the scheme and host of the site for the request. The
+// "api." prefix is removed from the host of requests to the API.
+func siteOrigin(req *web.Request) string {
+	scheme := req.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + strings.TrimPrefix(req.URL.Host, "api.")
+}
+
 var (
 	robotPat = regexp.MustCompile(`(:?\+https?://)|(?:\Wbot\W)|(?:^Python-urllib)|(?:^Go )|(?:^Java/)`)
 )
 
+// remoteHost returns the host of the client.
+func remoteHost(req *web.Request) string {
+	if h, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return h
+	}
+	return req.RemoteAddr
+}
+
 func isRobot(req *web.Request) bool {
 	if robotPat.MatchString(req.Header.Get(web.HeaderUserAgent)) {
 		return true
 	}
-	host := req.RemoteAddr
-	if h, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-		host = h
-	}
+	host := remoteHost(req)
 	n, err := db.IncrementCounter(host, 1)
 	if err != nil {
 		log.Printf("error incrementing counter for %s,  %v\n", host, err)
@@ -186,6 +224,80 @@ func httpEtag(pdoc *doc.Package, pkgs []database.Package, importerCount int) str
 	return fmt.Sprintf("\"%x\"", b)
 }
 
+// exportedNames returns the names of the exported package level
+// declarations in pdoc that can be referenced from other packages.
+func exportedNames(pdoc *doc.Package) []string {
+	var names []string
+	for _, f := range pdoc.Funcs {
+		names = append(names, f.Name)
+	}
+	addValues := func(values []*doc.Value) {
+		for _, v := range values {
+			names = append(names, v.Names...)
+		}
+	}
+	addValues(pdoc.Consts)
+	addValues(pdoc.Vars)
+	for _, t := range pdoc.Types {
+		names = append(names, t.Name)
+		for _, f := range t.Funcs {
+			names = append(names, f.Name)
+		}
+		addValues(t.Consts)
+		addValues(t.Vars)
+	}
+	return names
+}
+
+// packageTemplateData returns the name of the template without extension
+// and the template data for the documentation page of a package, command or
+// directory.
+func packageTemplateData(pdoc *doc.Package, pkgs []database.Package, importerCount int) (string, map[string]interface{}, error) {
+	template := "dir"
+	switch {
+	case pdoc.IsCmd:
+		template = "cmd"
+	case pdoc.Name != "":
+		template = "pkg"
+	}
+
+	var usage map[string]int
+	if pdoc.Name != "" && !pdoc.IsCmd {
+		var err error
+		usage, err = db.UsageCounts(pdoc.ImportPath, exportedNames(pdoc))
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	var implementations map[string]*database.ImplementationList
+	if len(pdoc.Types) > 0 && !pdoc.IsCmd {
+		var err error
+		implementations, err = db.Implementations(pdoc.ImportPath)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	var projectCoverage doc.Coverage
+	if pdoc.ProjectRoot != "" && (len(pkgs) > 0 || pdoc.ImportPath != pdoc.ProjectRoot) {
+		var err error
+		projectCoverage, err = db.ProjectCoverage(pdoc.ProjectRoot)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	return template, map[string]interface{}{
+		"pkgs":            pkgs,
+		"pdoc":            newTDoc(pdoc),
+		"importerCount":   importerCount,
+		"projectCoverage": projectCoverage,
+		"usage":           usage,
+		"implementations": implementations,
+	}, nil
+}
+
 func servePackage(resp web.Response, req *web.Request) error {
 	p := path.Clean(req.URL.Path)
 	if strings.HasPrefix(p, "/pkg/") {
@@ -199,6 +311,10 @@ func servePackage(resp web.Response, req *web.Request) error {
 		return statusHandler.ServeWeb(resp, req)
 	}
 
+	if isView(req, "health") {
+		return serveCrawlHealth(resp, req)
+	}
+
 	requestType := humanRequest
 	if isRobot(req) {
 		requestType = robotRequest
@@ -227,7 +343,11 @@ func servePackage(resp web.Response, req *web.Request) error {
 	}
 
 	switch {
-	case len(req.Form) == 0:
+	case len(req.Form) == 0 || isView(req, "format"):
+		if acceptsJSON(req) {
+			return writeAPIResponse(resp, req, newAPIDoc(pdoc, pkgs))
+		}
+
 		importerCount, err := db.ImporterCount(importPath)
 		if err != nil {
 			return err
@@ -250,29 +370,28 @@ func servePackage(resp web.Response, req *web.Request) error {
 			}
 		}
 
-		template := "dir"
-		switch {
-		case pdoc.IsCmd:
-			template = "cmd"
-		case pdoc.Name != "":
-			template = "pkg"
-		}
-		template += templateExt(req)
-
 		if srcFiles[importPath+"/_sourceMap"] != nil {
 			for _, f := range pdoc.Files {
 				if srcFiles[importPath+"/"+f.Name] != nil {
-					f.URL = fmt.Sprintf("/%s?file=%s", importPath, f.Name)
+					f.URL = (&url.URL{Path: "/" + importPath, RawQuery: "file=" + url.QueryEscape(f.Name)}).String()
+					pdoc.LineFmt = "%s#L%d"
+				}
+			}
+		} else {
+			for _, f := range pdoc.Files {
+				if f.Hash != "" {
+					f.URL = (&url.URL{Path: "/" + importPath, RawQuery: "file=" + url.QueryEscape(f.Name)}).String()
 					pdoc.LineFmt = "%s#L%d"
 				}
 			}
 		}
 
-		return executeTemplate(resp, template, status, web.Header{web.HeaderEtag: {etag}}, map[string]interface{}{
-			"pkgs":          pkgs,
-			"pdoc":          newTDoc(pdoc),
-			"importerCount": importerCount,
-		})
+		template, data, err := packageTemplateData(pdoc, pkgs, importerCount)
+		if err != nil {
+			return err
+		}
+		data["origin"] = siteOrigin(req)
+		return executeTemplate(resp, template+packageTemplateExt(req), status, web.Header{web.HeaderEtag: {etag}}, data)
 	case isView(req, "imports"):
 		if pdoc.Name == "" {
 			break
@@ -281,6 +400,13 @@ func servePackage(resp web.Response, req *web.Request) error {
 		if err != nil {
 			return err
 		}
+		if acceptsJSON(req) {
+			offset, limit, err := apiPage(req)
+			if err != nil {
+				return err
+			}
+			return writeAPIResponse(resp, req, pageAPIResults(pkgs, offset, limit))
+		}
 		return executeTemplate(resp, "imports.html", web.StatusOK, nil, map[string]interface{}{
 			"pkgs": pkgs,
 			"pdoc": newTDoc(pdoc),
@@ -293,13 +419,34 @@ func servePackage(resp web.Response, req *web.Request) error {
 			"Host": req.URL.Host,
 			"pdoc": newTDoc(pdoc),
 		})
-	case isView(req, "redir"):
-		if srcFiles == nil {
+	case isView(req, "lint"):
+		if pdoc.Name == "" {
+			break
+		}
+		return executeTemplate(resp, "lint.html", web.StatusOK, nil, map[string]interface{}{
+			"pdoc": newTDoc(pdoc),
+		})
+	case isView(req, "changes"):
+		if pdoc.Name == "" {
 			break
 		}
+		changes, err := db.Changes(importPath)
+		if err != nil {
+			return err
+		}
+		return executeTemplate(resp, "changes.html", web.StatusOK, nil, map[string]interface{}{
+			"changes": changes,
+			"pdoc":    newTDoc(pdoc),
+		})
+	case isView(req, "redir"):
 		f := srcFiles[importPath+"/_sourceMap"]
 		if f == nil {
-			break
+			id := req.Form.Get("redir")
+			fname := declFile(pdoc, id)
+			if fname == "" {
+				break
+			}
+			return web.Redirect(resp, req, (&url.URL{RawQuery: "file=" + url.QueryEscape(fname), Fragment: id}).String(), 301, nil)
 		}
 		r, err := f.Open()
 		if err != nil {
@@ -315,15 +462,24 @@ func servePackage(resp web.Response, req *web.Request) error {
 		if fname == "" {
 			break
 		}
-		return web.Redirect(resp, req, fmt.Sprintf("?file=%s#%s", fname, id), 301, nil)
+		return web.Redirect(resp, req, (&url.URL{RawQuery: "file=" + url.QueryEscape(fname), Fragment: id}).String(), 301, nil)
 	case isView(req, "file"):
-		if srcFiles == nil {
-			break
-		}
 		fname := req.Form.Get("file")
 		f := srcFiles[importPath+"/"+fname]
 		if f == nil {
-			break
+			code, url, err := annotatedSource(pdoc, fname)
+			if err != nil {
+				return err
+			}
+			if code == nil {
+				break
+			}
+			return executeTemplate(resp, "file.html", web.StatusOK, nil, map[string]interface{}{
+				"fname": fname,
+				"url":   url,
+				"src":   sourceFn(code),
+				"pdoc":  newTDoc(pdoc),
+			})
 		}
 		r, err := f.Open()
 		if err != nil {
@@ -352,6 +508,9 @@ func servePackage(resp web.Response, req *web.Request) error {
 		if pdoc.Name == "" {
 			break
 		}
+		if acceptsJSON(req) {
+			return apiV1PageHandler(apiImportersPage).ServeWeb(resp, req)
+		}
 		pkgs, err = db.Importers(importPath)
 		if err != nil {
 			return err
@@ -365,6 +524,25 @@ func servePackage(resp web.Response, req *web.Request) error {
 			"pkgs": pkgs,
 			"pdoc": newTDoc(pdoc),
 		})
+	case isView(req, "usedby"):
+		if pdoc.Name == "" {
+			break
+		}
+		name := req.Form.Get("usedby")
+		pkgs, err = db.UsedBy(importPath, name)
+		if err != nil {
+			return err
+		}
+		template := "usedby.html"
+		if requestType == robotRequest {
+			// Hide back links from robots.
+			template = "usedby_robot.html"
+		}
+		return executeTemplate(resp, template, web.StatusOK, nil, map[string]interface{}{
+			"name": name,
+			"pkgs": pkgs,
+			"pdoc": newTDoc(pdoc),
+		})
 	case isView(req, "import-graph"):
 		if pdoc.Name == "" {
 			break
@@ -433,6 +611,25 @@ func serveRefresh(resp web.Response, req *web.Request) error {
 	return web.Redirect(resp, req, "/"+path, 302, nil)
 }
 
+// serveCrawlHealth shows the crawl state of a path. The page does not crawl
+// the path so that authors can see why a package is missing.
+func serveCrawlHealth(resp web.Response, req *web.Request) error {
+	importPath := req.RouteVars["path"]
+	status, err := db.CrawlStatus(importPath)
+	if err != nil {
+		return err
+	}
+	blocked, err := db.IsBlocked(importPath)
+	if err != nil {
+		return err
+	}
+	return executeTemplate(resp, "health.html", web.StatusOK, nil, map[string]interface{}{
+		"status":  status,
+		"blocked": blocked,
+		"valid":   gosrc.IsValidRemotePath(importPath),
+	})
+}
+
 func serveGoIndex(resp web.Response, req *web.Request) error {
 	pkgs, err := db.GoIndex()
 	if err != nil {
@@ -601,13 +798,43 @@ func logError(req *web.Request, err error, r interface{}) {
 	}
 }
 
-func serveAPISearch(resp web.Response, req *web.Request) error {
-	q := strings.TrimSpace(req.Form.Get("q"))
-	pkgs, err := db.Query(q)
+// apiListHandler returns a handler for an API endpoint that responds with
+// all of the results returned by fn. The results are a slice.
+func apiListHandler(fn func(*web.Request) (interface{}, error)) web.Handler {
+	return web.HandlerFunc(func(resp web.Response, req *web.Request) error {
+		results, err := fn(req)
+		if err != nil {
+			return err
+		}
+		var data struct {
+			Results interface{} `json:"results"`
+		}
+		data.Results = results
+		w := resp.Start(web.StatusOK, web.Header{web.HeaderContentType: {"application/json; charset=utf-8"}})
+		return json.NewEncoder(w).Encode(&data)
+	})
+}
+
+// splitAPIName splits the route path for a declaration in a package into
+// the import path and name.
+func splitAPIName(req *web.Request) (string, string, error) {
+	p := req.RouteVars["path"]
+	i := strings.LastIndex(p, ".")
+	if i < 0 || strings.Contains(p[i:], "/") {
+		return "", "", &web.Error{Status: web.StatusNotFound}
+	}
+	return p[:i], p[i+1:], nil
+}
+
+func apiSearchResults(req *web.Request) (interface{}, error) {
+	return db.Query(strings.TrimSpace(req.Form.Get("q")))
+}
+
+func serveAPIPackages(resp web.Response, req *web.Request) error {
+	pkgs, err := db.AllPackages()
 	if err != nil {
 		return err
 	}
-
 	var data struct {
 		Results []database.Package `json:"results"`
 	}
@@ -616,38 +843,194 @@ func serveAPISearch(resp web.Response, req *web.Request) error {
 	return json.NewEncoder(w).Encode(&data)
 }
 
-func serveAPIPackages(resp web.Response, req *web.Request) error {
-	pkgs, err := db.AllPackages()
+func apiImportersResults(req *web.Request) (interface{}, error) {
+	return db.Importers(req.RouteVars["path"])
+}
+
+func serveAPIDoc(resp web.Response, req *web.Request) error {
+	importPath := req.RouteVars["path"]
+	pdoc, pkgs, _, err := db.Get(importPath)
 	if err != nil {
 		return err
 	}
-	var data struct {
-		Results []database.Package `json:"results"`
+	if pdoc == nil {
+		if len(pkgs) == 0 {
+			return &web.Error{Status: web.StatusNotFound}
+		}
+		pdoc = &doc.Package{ImportPath: importPath}
 	}
-	data.Results = pkgs
 	w := resp.Start(web.StatusOK, web.Header{web.HeaderContentType: {"application/json; charset=utf-8"}})
-	return json.NewEncoder(w).Encode(&data)
+	return json.NewEncoder(w).Encode(newAPIDoc(pdoc, pkgs))
 }
 
-func serveAPIImporters(resp web.Response, req *web.Request) error {
-	pkgs, err := db.Importers(req.RouteVars["path"])
+func apiImportsResults(req *web.Request) (interface{}, error) {
+	pdoc, _, _, err := db.Get(req.RouteVars["path"])
+	if err != nil {
+		return nil, err
+	}
+	if pdoc == nil || pdoc.Name == "" {
+		return nil, &web.Error{Status: web.StatusNotFound}
+	}
+	return db.Packages(pdoc.Imports)
+}
+
+type apiGraph struct {
+	Packages []database.Package `json:"packages"`
+	Edges    [][2]int           `json:"edges"`
+}
+
+func newAPIGraph(pdoc *doc.Package, hide bool) (*apiGraph, error) {
+	pkgs, edges, err := db.ImportGraph(pdoc, hide)
+	if err != nil {
+		return nil, err
+	}
+	if edges == nil {
+		edges = [][2]int{}
+	}
+	return &apiGraph{Packages: pkgs, Edges: edges}, nil
+}
+
+func serveAPIGraph(resp web.Response, req *web.Request) error {
+	pdoc, _, _, err := db.Get(req.RouteVars["path"])
 	if err != nil {
 		return err
 	}
-	var data struct {
-		Results []database.Package `json:"results"`
+	if pdoc == nil || pdoc.Name == "" {
+		return &web.Error{Status: web.StatusNotFound}
+	}
+	data, err := newAPIGraph(pdoc, req.Form.Get("hide") == "1")
+	if err != nil {
+		return err
 	}
-	data.Results = pkgs
 	w := resp.Start(web.StatusOK, web.Header{web.HeaderContentType: {"application/json; charset=utf-8"}})
-	return json.NewEncoder(w).Encode(&data)
+	return json.NewEncoder(w).Encode(data)
+}
+
+func apiUsedByResults(req *web.Request) (interface{}, error) {
+	importPath, name, err := splitAPIName(req)
+	if err != nil {
+		return nil, err
+	}
+	return db.UsedBy(importPath, name)
+}
+
+type apiField struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Tag        string `json:"tag,omitempty"`
+	Doc        string `json:"doc,omitempty"`
+	Deprecated string `json:"deprecated,omitempty"`
+	Embedded   bool   `json:"embedded,omitempty"`
+}
+
+func apiFieldsResults(req *web.Request) (interface{}, error) {
+	importPath, name, err := splitAPIName(req)
+	if err != nil {
+		return nil, err
+	}
+	pdoc, _, _, err := db.Get(importPath)
+	if err != nil {
+		return nil, err
+	}
+	if pdoc == nil {
+		return nil, &web.Error{Status: web.StatusNotFound}
+	}
+	for _, t := range pdoc.Types {
+		if t.Name != name {
+			continue
+		}
+		results := make([]apiField, len(t.Fields))
+		for j, f := range t.Fields {
+			results[j] = apiField{
+				Name:       f.Name,
+				Type:       f.Type.Text,
+				Tag:        f.Tag,
+				Doc:        f.Doc,
+				Deprecated: f.Deprecated,
+				Embedded:   f.Embedded,
+			}
+		}
+		return results, nil
+	}
+	return nil, &web.Error{Status: web.StatusNotFound}
+}
+
+func serveAPIMarkdown(resp web.Response, req *web.Request) error {
+	importPath := req.RouteVars["path"]
+	pdoc, pkgs, _, err := db.Get(importPath)
+	if err != nil {
+		return err
+	}
+	if pdoc == nil {
+		return &web.Error{Status: web.StatusNotFound}
+	}
+	importerCount, err := db.ImporterCount(importPath)
+	if err != nil {
+		return err
+	}
+	template, data, err := packageTemplateData(pdoc, pkgs, importerCount)
+	if err != nil {
+		return err
+	}
+	data["origin"] = siteOrigin(req)
+	return executeTemplate(resp, template+".md", web.StatusOK, nil, data)
+}
+
+// apiTypeImplementations returns the implementations of an interface or
+// the interfaces implemented by a concrete type.
+func apiTypeImplementations(req *web.Request, isInterface bool) (interface{}, error) {
+	importPath, name, err := splitAPIName(req)
+	if err != nil {
+		return nil, err
+	}
+	pdoc, _, _, err := db.Get(importPath)
+	if err != nil {
+		return nil, err
+	}
+	if pdoc == nil {
+		return nil, &web.Error{Status: web.StatusNotFound}
+	}
+	for _, t := range pdoc.Types {
+		if t.Name != name {
+			continue
+		}
+		if t.IsInterface != isInterface {
+			break
+		}
+		implementations, err := db.Implementations(pdoc.ImportPath)
+		if err != nil {
+			return nil, err
+		}
+		results := []database.TypeRef{}
+		if l := implementations[t.Name]; l != nil {
+			results = l.Types
+		}
+		return results, nil
+	}
+	return nil, &web.Error{Status: web.StatusNotFound}
+}
+
+func apiImplementationsResults(req *web.Request) (interface{}, error) {
+	return apiTypeImplementations(req, true)
+}
+
+func apiImplementsResults(req *web.Request) (interface{}, error) {
+	return apiTypeImplementations(req, false)
+}
+
+func apiChangesResults(req *web.Request) (interface{}, error) {
+	return db.Changes(req.RouteVars["path"])
 }
 
 func handleError(resp web.Response, req *web.Request, status int, err error, r interface{}) {
 	logError(req, err, r)
-	switch status {
-	case 0:
+	switch {
+	case status == 0:
 		// nothing to do
-	case web.StatusNotFound:
+	case acceptsJSON(req):
+		status, info := classifyAPIError(status, err)
+		writeAPIError(resp, status, info)
+	case status == web.StatusNotFound:
 		executeTemplate(resp, "notfound"+templateExt(req), status, nil, nil)
 	default:
 		s := web.StatusText(status)
@@ -667,14 +1050,8 @@ func handleAPIError(resp web.Response, req *web.Request, status int, err error,
 	case 0:
 		// nothing to do
 	default:
-		var data struct {
-			Error struct {
-				Message string `json:"message"`
-			} `json:"error"`
-		}
-		data.Error.Message = web.StatusText(status)
-		w := resp.Start(status, web.Header{web.HeaderContentType: {"application/json; charset=utf-8"}})
-		json.NewEncoder(w).Encode(&data)
+		status, info := classifyAPIError(status, err)
+		writeAPIError(resp, status, info)
 	}
 }
 
@@ -693,24 +1070,46 @@ var (
 	gzAssetsDir     = flag.String("gzassets", "", "Base directory for compressed static files.")
 	getTimeout      = flag.Duration("get_timeout", 8*time.Second, "Time to wait for package update from the VCS.")
 	firstGetTimeout = flag.Duration("first_get_timeout", 5*time.Second, "Time to wait for first fetch of package from the VCS.")
-	maxAge          = flag.Duration("max_age", 24*time.Hour, "Update package documents older than this age.")
 	httpAddr        = flag.String("http", ":8080", "Listen for HTTP connections on this address")
 	srcZip          = flag.String("srcZip", "", "")
 	srcFiles        = make(map[string]*zip.File)
 	statusHandler   web.Handler
+	httpClient      = crawler.HTTPClient
 )
 
 var cacheBusters = map[string]string{}
 
-func dataHandler(cacheBusterKey, contentType, dir string, names ...string) web.Handler {
+// The files concatenated to create the site script and style sheet.
+var (
+	siteJSFiles = []string{
+		"third_party/jquery.timeago.js",
+		"third_party/typeahead.min.js",
+		"third_party/bootstrap/js/bootstrap.min.js",
+		"site.js",
+	}
+	siteCSSFiles = []string{
+		"third_party/bootstrap/css/bootstrap.min.css",
+		"site.css",
+	}
+)
+
+func readFiles(dir string, names ...string) ([]byte, error) {
 	var data []byte
 	for _, name := range names {
 		p, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 		data = append(data, p...)
 	}
+	return data, nil
+}
+
+func dataHandler(cacheBusterKey, contentType, dir string, names ...string) web.Handler {
+	data, err := readFiles(dir, names...)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	h := md5.New()
 	h.Write(data)
@@ -735,17 +1134,30 @@ func main() {
 		}
 	}
 
+	if *adminUsersFile != "" {
+		var err error
+		adminUsers, err = readAdminUsers(*adminUsersFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if err := parseHTMLTemplates([][]string{
 		{"about.html", "common.html", "layout.html"},
+		{"admin.html", "common.html", "layout.html"},
 		{"bot.html", "common.html", "layout.html"},
+		{"changes.html", "common.html", "layout.html"},
 		{"cmd.html", "common.html", "layout.html"},
 		{"dir.html", "common.html", "layout.html"},
 		{"home.html", "common.html", "layout.html"},
 		{"importers.html", "common.html", "layout.html"},
 		{"importers_robot.html", "common.html", "layout.html"},
+		{"usedby.html", "common.html", "layout.html"},
+		{"usedby_robot.html", "common.html", "layout.html"},
 		{"imports.html", "common.html", "layout.html"},
 		{"file.html", "common.html", "layout.html"},
 		{"index.html", "common.html", "layout.html"},
+		{"lint.html", "common.html", "layout.html"},
 		{"notfound.html", "common.html", "layout.html"},
 		{"pkg.html", "common.html", "layout.html"},
 		{"results.html", "common.html", "layout.html"},
@@ -753,6 +1165,7 @@ func main() {
 		{"std.html", "common.html", "layout.html"},
 		{"subrepo.html", "common.html", "layout.html"},
 		{"graph.html", "common.html"},
+		{"health.html", "common.html", "layout.html"},
 	}); err != nil {
 		log.Fatal(err)
 	}
@@ -764,6 +1177,9 @@ func main() {
 		{"notfound.txt", "common.txt"},
 		{"pkg.txt", "common.txt"},
 		{"results.txt", "common.txt"},
+		{"cmd.md", "common.md"},
+		{"dir.md", "common.md"},
+		{"pkg.md", "common.md"},
 		{"opensearch.xml"},
 	}); err != nil {
 		log.Fatal(err)
@@ -774,8 +1190,31 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	docCrawler = crawler.New(db, httpClient)
+
+	if *exportDir != "" {
+		if err := exportSite(*exportDir, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := db.CheckLocal(*localPath != ""); err != nil {
+		log.Fatal(err)
+	}
 
-	go runBackgroundTasks()
+	if *localPath != "" {
+		go watchLocal(updateLocal(storedLocal()))
+	} else {
+		if *crawlWorkers > 0 {
+			// The concurrent crawler replaces the serial crawler.
+			*crawlInterval = 0
+			go func() {
+				log.Fatal(docCrawler.RunPool(*crawlWorkers))
+			}()
+		}
+		go runBackgroundTasks()
+	}
 
 	staticConfig := &web.StaticConfig{
 		Header:      web.Header{web.HeaderCacheControl: {"public, max-age=3600"}},
@@ -792,20 +1231,25 @@ func main() {
 	r.Add("/google3d2f3cd4cc2bb44b.html").Get(staticConfig.FileHandler("google3d2f3cd4cc2bb44b.html"))
 	r.Add("/humans.txt").Get(staticConfig.FileHandler("humans.txt"))
 	r.Add("/robots.txt").Get(staticConfig.FileHandler("apiRobots.txt"))
-	r.Add("/search").GetFunc(serveAPISearch)
+	r.Add("/search").Get(apiListHandler(apiSearchResults))
 	r.Add("/packages").GetFunc(serveAPIPackages)
-	r.Add("/importers/<path:.+>").GetFunc(serveAPIImporters)
-
-	h.Add("api.<:.*>", web.ErrorHandler(handleAPIError, web.FormAndCookieHandler(6000, false, r)))
+	r.Add("/importers/<path:.+>").Get(apiListHandler(apiImportersResults))
+	r.Add("/changes/<path:.+>").Get(apiListHandler(apiChangesResults))
+	r.Add("/usedby/<path:.+>").Get(apiListHandler(apiUsedByResults))
+	r.Add("/fields/<path:.+>").Get(apiListHandler(apiFieldsResults))
+	r.Add("/implementations/<path:.+>").Get(apiListHandler(apiImplementationsResults))
+	r.Add("/implements/<path:.+>").Get(apiListHandler(apiImplementsResults))
+	r.Add("/doc/<path:.+>").GetFunc(serveAPIDoc)
+	r.Add("/imports/<path:.+>").Get(apiListHandler(apiImportsResults))
+	r.Add("/graph/<path:.+>").GetFunc(serveAPIGraph)
+	r.Add("/markdown/<path:.+>").GetFunc(serveAPIMarkdown)
+	addAPIV1Routes(r)
+
+	h.Add("api.<:.*>", apiQuotaHandler(web.ErrorHandler(handleAPIError, web.FormAndCookieHandler(6000, false, r))))
 
 	r = web.NewRouter()
-	r.Add("/-/site.js").Get(dataHandler("site.js", "text/javascript", *assetsDir,
-		"third_party/jquery.timeago.js",
-		"third_party/typeahead.min.js",
-		"third_party/bootstrap/js/bootstrap.min.js",
-		"site.js"))
-	r.Add("/-/site.css").Get(dataHandler("site.css", "text/css", *assetsDir,
-		"third_party/bootstrap/css/bootstrap.min.css", "site.css"))
+	r.Add("/-/site.js").Get(dataHandler("site.js", "text/javascript", *assetsDir, siteJSFiles...))
+	r.Add("/-/site.css").Get(dataHandler("site.css", "text/css", *assetsDir, siteCSSFiles...))
 	r.Add("/").GetFunc(serveHome)
 	r.Add("/-/about").GetFunc(serveAbout)
 	r.Add("/-/bot").GetFunc(serveBot)
@@ -815,6 +1259,7 @@ func main() {
 	r.Add("/-/subrepo").GetFunc(serveGoSubrepoIndex)
 	r.Add("/-/index").GetFunc(serveIndex)
 	r.Add("/-/refresh").PostFunc(serveRefresh)
+	r.Add("/-/admin").Get(adminHandler(serveAdmin)).Post(adminHandler(serveAdminAction))
 	r.Add("/-/status.png").Get(statusHandler)
 	r.Add("/-/static/<path:.*>").Get(staticConfig.DirectoryHandler("static"))
 	r.Add("/a/index").Get(web.RedirectHandler("/-/index", 301))
@@ -825,7 +1270,7 @@ func main() {
 	r.Add("/robots.txt").Get(staticConfig.FileHandler("robots.txt"))
 	r.Add("/BingSiteAuth.xml").Get(staticConfig.FileHandler("BingSiteAuth.xml"))
 	r.Add("/C").Get(web.RedirectHandler("http://golang.org/doc/articles/c_go_cgo.html", 301))
-	r.Add("/<path:.+>").GetFunc(servePackage)
+	r.Add("/<path:.+>").Get(negotiatedHandler(web.HandlerFunc(servePackage)))
 
 	h.Add("<:.*>", web.ErrorHandler(handleError, web.FormAndCookieHandler(1000, false, r)))
 
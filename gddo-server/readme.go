@@ -0,0 +1,665 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// This file implements safe rendering of README files to HTML. The renderers
+// support the commonly used subset of Markdown and reStructuredText. All
+// text is escaped and only a fixed set of tags is emitted. Raw HTML in the
+// README is displayed as text.
+
+package main
+
+import (
+	"bytes"
+	htemp "html/template"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/garyburd/gddo/doc"
+)
+
+// renderReadme formats a README file as HTML.
+func renderReadme(r *doc.Readme) string {
+	base, err := url.Parse(r.URL)
+	if err != nil || !base.IsAbs() {
+		base = nil
+	}
+	rr := &readmeRenderer{base: base}
+	lines := strings.Split(strings.Replace(r.Text, "\r\n", "\n", -1), "\n")
+	switch strings.ToLower(path.Ext(r.Name)) {
+	case ".md", ".markdown", ".mdown":
+		rr.markdown(lines)
+	case ".rst":
+		rr.rst(lines)
+	default:
+		rr.pre(lines)
+	}
+	return rr.buf.String()
+}
+
+type readmeRenderer struct {
+	buf  bytes.Buffer
+	base *url.URL
+
+	// Heading adornments in the order seen. Used by the reStructuredText
+	// renderer to determine heading levels.
+	adornments []string
+}
+
+// url returns a safe URL for a link or image in the README. Relative URLs
+// are resolved against the URL of the README file in the VCS browser. The
+// empty string is returned for URLs that cannot be used.
+func (rr *readmeRenderer) url(s string, image bool) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+	switch {
+	case safeURLSchemes[u.Scheme]:
+		return u.String()
+	case u.Scheme != "" || u.Host != "":
+		return ""
+	}
+	if u.Path == "" {
+		// Fragment only.
+		return u.String()
+	}
+	if rr.base == nil {
+		return ""
+	}
+	u = rr.base.ResolveReference(u)
+	if image && u.Host == "github.com" && strings.Contains(u.Path, "/blob/") {
+		// Use the raw file instead of the file browser page.
+		q := u.Query()
+		q.Set("raw", "true")
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+func (rr *readmeRenderer) escape(s string) {
+	htemp.HTMLEscape(&rr.buf, []byte(s))
+}
+
+func (rr *readmeRenderer) pre(lines []string) {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	rr.buf.WriteString("<pre>")
+	rr.escape(strings.Join(lines, "\n"))
+	rr.buf.WriteString("</pre>\n")
+}
+
+func (rr *readmeRenderer) heading(level int, text string, inline func(string)) {
+	// Page headings use h2 and h3. Start README headings at h4.
+	level += 3
+	if level > 6 {
+		level = 6
+	}
+	tag := string('0' + byte(level))
+	rr.buf.WriteString("<h" + tag + ">")
+	inline(strings.TrimSpace(text))
+	rr.buf.WriteString("</h" + tag + ">\n")
+}
+
+func (rr *readmeRenderer) link(href, title string, text func()) {
+	if href == "" {
+		text()
+		return
+	}
+	rr.buf.WriteString(`<a href="`)
+	rr.escape(href)
+	if title != "" {
+		rr.buf.WriteString(`" title="`)
+		rr.escape(title)
+	}
+	rr.buf.WriteString(`" rel="nofollow">`)
+	text()
+	rr.buf.WriteString("</a>")
+}
+
+func (rr *readmeRenderer) image(src, alt string) {
+	if src == "" {
+		rr.escape(alt)
+		return
+	}
+	rr.buf.WriteString(`<img src="`)
+	rr.escape(src)
+	rr.buf.WriteString(`" alt="`)
+	rr.escape(alt)
+	rr.buf.WriteString(`">`)
+}
+
+// Markdown
+
+var (
+	mdATXHeadingPat = regexp.MustCompile(`^(#{1,6})\s*(.*?)\s*#*\s*$`)
+	mdSetextPat     = regexp.MustCompile(`^(=+|-+)\s*$`)
+	mdRulePat       = regexp.MustCompile(`^ {0,3}(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	mdFencePat      = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	mdListItemPat   = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])(\s+|$)`)
+	mdQuotePat      = regexp.MustCompile(`^ {0,3}> ?`)
+)
+
+// mdBlockStart returns true if line starts a block that interrupts a
+// paragraph.
+func mdBlockStart(line string) bool {
+	return mdATXHeadingPat.MatchString(line) ||
+		mdRulePat.MatchString(line) ||
+		mdFencePat.MatchString(line) ||
+		mdQuotePat.MatchString(line) ||
+		mdListItemPat.MatchString(line)
+}
+
+func (rr *readmeRenderer) markdown(lines []string) {
+	for len(lines) > 0 {
+		line := lines[0]
+		switch {
+		case isBlank(line):
+			lines = lines[1:]
+		case mdFencePat.MatchString(line):
+			fence := mdFencePat.FindStringSubmatch(line)[1]
+			i := 1
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				i++
+			}
+			rr.pre(lines[1:i])
+			if i < len(lines) {
+				i++
+			}
+			lines = lines[i:]
+		case indent(line) >= 4:
+			i := 1
+			for i < len(lines) && (isBlank(lines[i]) || indent(lines[i]) >= 4) {
+				i++
+			}
+			rr.pre(unindent(lines[:i], 4))
+			lines = lines[i:]
+		case mdATXHeadingPat.MatchString(line):
+			m := mdATXHeadingPat.FindStringSubmatch(line)
+			rr.heading(len(m[1]), m[2], rr.mdInline)
+			lines = lines[1:]
+		case mdRulePat.MatchString(line):
+			rr.buf.WriteString("<hr>\n")
+			lines = lines[1:]
+		case mdQuotePat.MatchString(line):
+			i := 0
+			var quote []string
+			for i < len(lines) && !isBlank(lines[i]) {
+				quote = append(quote, mdQuotePat.ReplaceAllString(lines[i], ""))
+				i++
+			}
+			rr.buf.WriteString("<blockquote>\n")
+			rr.markdown(quote)
+			rr.buf.WriteString("</blockquote>\n")
+			lines = lines[i:]
+		case mdListItemPat.MatchString(line):
+			lines = rr.mdList(lines)
+		default:
+			i := 1
+			for i < len(lines) && !isBlank(lines[i]) && !mdBlockStart(lines[i]) && !mdSetextPat.MatchString(lines[i]) {
+				i++
+			}
+			if i < len(lines) && mdSetextPat.MatchString(lines[i]) && !isBlank(lines[i]) {
+				level := 1
+				if lines[i][0] == '-' {
+					level = 2
+				}
+				rr.heading(level, strings.Join(lines[:i], " "), rr.mdInline)
+				i++
+			} else {
+				rr.buf.WriteString("<p>")
+				rr.mdInline(strings.Join(lines[:i], "\n"))
+				rr.buf.WriteString("</p>\n")
+			}
+			lines = lines[i:]
+		}
+	}
+}
+
+// mdList renders the list starting at lines[0] and returns the remaining
+// lines.
+func (rr *readmeRenderer) mdList(lines []string) []string {
+	m := mdListItemPat.FindStringSubmatch(lines[0])
+	ordered := m[2][0] >= '0' && m[2][0] <= '9'
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	rr.buf.WriteString("<" + tag + ">\n")
+	for len(lines) > 0 {
+		m := mdListItemPat.FindStringSubmatch(lines[0])
+		if m == nil || (m[2][0] >= '0' && m[2][0] <= '9') != ordered {
+			break
+		}
+		width := len(m[0])
+		if isBlank(m[3]) {
+			width = len(m[1]) + len(m[2]) + 1
+		}
+		item := []string{lines[0][len(m[0]):]}
+		i := 1
+		loose := false
+		for i < len(lines) {
+			if isBlank(lines[i]) {
+				if i+1 < len(lines) && indent(lines[i+1]) >= width {
+					loose = true
+					item = append(item, "")
+					i++
+					continue
+				}
+				break
+			}
+			if indent(lines[i]) < width && mdBlockStart(lines[i]) {
+				break
+			}
+			item = append(item, unindent(lines[i:i+1], width)[0])
+			i++
+		}
+		lines = lines[i:]
+		for len(lines) > 0 && isBlank(lines[0]) {
+			lines = lines[1:]
+		}
+		rr.buf.WriteString("<li>")
+		if !loose && !mdBlockStartAny(item[1:]) {
+			rr.mdInline(strings.Join(item, "\n"))
+		} else {
+			rr.markdown(item)
+		}
+		rr.buf.WriteString("</li>\n")
+	}
+	rr.buf.WriteString("</" + tag + ">\n")
+	return lines
+}
+
+func mdBlockStartAny(lines []string) bool {
+	for _, line := range lines {
+		if mdBlockStart(line) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	mdLinkPat     = regexp.MustCompile(`^\[((?:[^\[\]]|\[[^\[\]]*\])*)\]\(\s*<?([^\s()<>]*(?:\([^\s()]*\))?[^\s()<>]*)>?(?:\s+"([^"]*)")?\s*\)`)
+	mdAutoLinkPat = regexp.MustCompile(`^<((?:https?://|mailto:)[^\s<>]+)>`)
+)
+
+// mdInline formats inline Markdown text.
+func (rr *readmeRenderer) mdInline(s string) {
+	rr.mdInlineLinks(s, true)
+}
+
+func (rr *readmeRenderer) mdInlineLinks(s string, links bool) {
+	var text []byte
+	u := make(unmatched)
+	flush := func() {
+		rr.escape(string(text))
+		text = text[:0]
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!<>", s[i+1]) >= 0:
+			text = append(text, s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			n := 1
+			for i+n < len(s) && s[i+n] == '`' {
+				n++
+			}
+			delim := s[i : i+n]
+			if j := u.index(s, i+n, delim); j >= 0 {
+				flush()
+				rr.buf.WriteString("<code>")
+				rr.escape(strings.TrimSpace(s[i+n : j]))
+				rr.buf.WriteString("</code>")
+				i = j + n
+				continue
+			}
+			text = append(text, delim...)
+			i += n
+			continue
+		case c == '!' && strings.HasPrefix(s[i+1:], "["):
+			if m := mdLinkPat.FindStringSubmatch(s[i+1:]); m != nil {
+				flush()
+				rr.image(rr.url(m[2], true), m[1])
+				i += 1 + len(m[0])
+				continue
+			}
+		case c == '[' && links:
+			if m := mdLinkPat.FindStringSubmatch(s[i:]); m != nil {
+				flush()
+				rr.link(rr.url(m[2], false), m[3], func() { rr.mdInlineLinks(m[1], false) })
+				i += len(m[0])
+				continue
+			}
+		case c == '<' && links:
+			if m := mdAutoLinkPat.FindStringSubmatch(s[i:]); m != nil {
+				flush()
+				rr.link(rr.url(m[1], false), "", func() { rr.escape(m[1]) })
+				i += len(m[0])
+				continue
+			}
+		case c == 'h' && links && (i == 0 || !isWordByte(s[i-1])):
+			if m := urlPat.FindString(s[i:]); m != "" {
+				flush()
+				rr.link(rr.url(m, false), "", func() { rr.escape(m) })
+				i += len(m)
+				continue
+			}
+		case c == '*' || c == '_':
+			n := 1
+			if i+1 < len(s) && s[i+1] == c {
+				n = 2
+			}
+			delim := s[i : i+n]
+			if j := u.emphasisEnd(s, i+n, delim); j > 0 && (c == '*' || ((i == 0 || !isWordByte(s[i-1])) && (j+n >= len(s) || !isWordByte(s[j+n])))) {
+				flush()
+				tag := "em"
+				if n == 2 {
+					tag = "strong"
+				}
+				rr.buf.WriteString("<" + tag + ">")
+				rr.mdInlineLinks(s[i+n:j], links)
+				rr.buf.WriteString("</" + tag + ">")
+				i = j + n
+				continue
+			}
+			text = append(text, delim...)
+			i += n
+			continue
+		case c == '\n' && len(text) >= 2 && text[len(text)-1] == ' ' && text[len(text)-2] == ' ':
+			flush()
+			rr.buf.WriteString("<br>\n")
+			i++
+			continue
+		}
+		text = append(text, c)
+		i++
+	}
+	flush()
+}
+
+// unmatched maps an inline delimiter to the position in the text after which
+// the delimiter has no match. Unmatched opening delimiters are common in
+// READMEs. Recording them keeps each opening delimiter from scanning to the
+// end of the text again.
+type unmatched map[string]int
+
+// index returns the index of delim in s at or after start or -1 if delim is
+// not found.
+func (u unmatched) index(s string, start int, delim string) int {
+	if k, ok := u[delim]; ok && start >= k {
+		return -1
+	}
+	j := strings.Index(s[start:], delim)
+	if j < 0 {
+		u[delim] = start
+		return -1
+	}
+	return start + j
+}
+
+// emphasisEnd returns the index of the closing emphasis delimiter or -1 if
+// the delimiter is not found.
+func (u unmatched) emphasisEnd(s string, start int, delim string) int {
+	if start >= len(s) || s[start] == ' ' || s[start] == '\n' {
+		return -1
+	}
+	if k, ok := u[delim]; ok && start >= k {
+		return -1
+	}
+	for j := start + 1; j+len(delim) <= len(s); j++ {
+		if strings.HasPrefix(s[j:], delim) && s[j-1] != ' ' && s[j-1] != '\n' {
+			if len(delim) == 1 && j+1 < len(s) && s[j+1] == delim[0] {
+				j++
+				continue
+			}
+			return j
+		}
+	}
+	u[delim] = start
+	return -1
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// reStructuredText
+
+var (
+	rstListItemPat  = regexp.MustCompile(`^([-*+]|\d+\.|#\.)\s+`)
+	rstDirectivePat = regexp.MustCompile(`^\.\.\s+([a-zA-Z-]+)::\s*(.*)$`)
+	rstLinkPat      = regexp.MustCompile("^`([^`<]*?)\\s*<([^`>]+)>`__?")
+)
+
+// isAdornment returns true if line is a section title adornment or a
+// transition.
+func isAdornment(line string) bool {
+	line = strings.TrimRight(line, " \t")
+	if len(line) < 3 || strings.IndexByte("=-~^\"'`#*+:.", line[0]) < 0 {
+		return false
+	}
+	return strings.Count(line, line[:1]) == len(line)
+}
+
+func (rr *readmeRenderer) rstHeading(adornment, text string) {
+	level := 0
+	for i, a := range rr.adornments {
+		if a == adornment {
+			level = i + 1
+		}
+	}
+	if level == 0 {
+		rr.adornments = append(rr.adornments, adornment)
+		level = len(rr.adornments)
+	}
+	rr.heading(level, text, rr.rstInline)
+}
+
+// rstIndentedBlock returns the number of lines in the indented block at the
+// start of lines. Blank lines are included in the block.
+func rstIndentedBlock(lines []string) int {
+	i := 0
+	for i < len(lines) && (isBlank(lines[i]) || indent(lines[i]) > 0) {
+		i++
+	}
+	for i > 0 && isBlank(lines[i-1]) {
+		i--
+	}
+	return i
+}
+
+func (rr *readmeRenderer) rstLiteral(lines []string) []string {
+	for len(lines) > 0 && isBlank(lines[0]) {
+		lines = lines[1:]
+	}
+	n := rstIndentedBlock(lines)
+	if n > 0 {
+		rr.pre(unindent(lines[:n], indent(lines[0])))
+	}
+	return lines[n:]
+}
+
+func (rr *readmeRenderer) rst(lines []string) {
+	for len(lines) > 0 {
+		line := lines[0]
+		switch {
+		case isBlank(line):
+			lines = lines[1:]
+		case isAdornment(line) && len(lines) >= 3 && !isBlank(lines[1]) && strings.TrimSpace(lines[2]) == strings.TrimSpace(line):
+			// Title with overline.
+			rr.rstHeading("over"+line[:1], lines[1])
+			lines = lines[3:]
+		case len(lines) >= 2 && isAdornment(lines[1]) && indent(line) == 0:
+			rr.rstHeading(lines[1][:1], line)
+			lines = lines[2:]
+		case isAdornment(line):
+			// Transition.
+			rr.buf.WriteString("<hr>\n")
+			lines = lines[1:]
+		case rstDirectivePat.MatchString(line):
+			m := rstDirectivePat.FindStringSubmatch(line)
+			lines = lines[1:]
+			n := rstIndentedBlock(lines)
+			body := lines[:n]
+			lines = lines[n:]
+			switch m[1] {
+			case "code", "code-block", "sourcecode":
+				// Skip directive options.
+				for len(body) > 0 && strings.HasPrefix(strings.TrimSpace(body[0]), ":") {
+					body = body[1:]
+				}
+				rr.rstLiteral(body)
+			case "image":
+				rr.image(rr.url(m[2], true), m[2])
+				rr.buf.WriteString("\n")
+			}
+		case strings.HasPrefix(line, ".. "):
+			// Comment, hyperlink target or footnote.
+			lines = lines[1:]
+			lines = lines[rstIndentedBlock(lines):]
+		case rstListItemPat.MatchString(line):
+			lines = rr.rstList(lines)
+		case indent(line) > 0:
+			n := rstIndentedBlock(lines)
+			rr.buf.WriteString("<blockquote>\n")
+			rr.rst(unindent(lines[:n], indent(line)))
+			rr.buf.WriteString("</blockquote>\n")
+			lines = lines[n:]
+		default:
+			i := 1
+			for i < len(lines) && !isBlank(lines[i]) && indent(lines[i]) == 0 {
+				i++
+			}
+			text := strings.Join(lines[:i], "\n")
+			lines = lines[i:]
+			literal := strings.HasSuffix(text, "::")
+			if literal {
+				text = strings.TrimSpace(text[:len(text)-2])
+				if text != "" && !strings.HasSuffix(text, " ") {
+					text += ":"
+				}
+			}
+			if text != "" {
+				rr.buf.WriteString("<p>")
+				rr.rstInline(text)
+				rr.buf.WriteString("</p>\n")
+			}
+			if literal {
+				lines = rr.rstLiteral(lines)
+			}
+		}
+	}
+}
+
+func (rr *readmeRenderer) rstList(lines []string) []string {
+	m := rstListItemPat.FindStringSubmatch(lines[0])
+	ordered := m[1][0] == '#' || m[1][0] >= '0' && m[1][0] <= '9'
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	rr.buf.WriteString("<" + tag + ">\n")
+	for len(lines) > 0 {
+		m := rstListItemPat.FindStringSubmatch(lines[0])
+		if m == nil || (m[1][0] == '#' || m[1][0] >= '0' && m[1][0] <= '9') != ordered {
+			break
+		}
+		item := []string{lines[0][len(m[0]):]}
+		lines = lines[1:]
+		n := rstIndentedBlock(lines)
+		item = append(item, unindent(lines[:n], len(m[0]))...)
+		lines = lines[n:]
+		for len(lines) > 0 && isBlank(lines[0]) {
+			lines = lines[1:]
+		}
+		rr.buf.WriteString("<li>")
+		if len(item) == 1 {
+			rr.rstInline(item[0])
+		} else {
+			rr.rst(item)
+		}
+		rr.buf.WriteString("</li>\n")
+	}
+	rr.buf.WriteString("</" + tag + ">\n")
+	return lines
+}
+
+// rstInline formats inline reStructuredText.
+func (rr *readmeRenderer) rstInline(s string) {
+	var text []byte
+	u := make(unmatched)
+	flush := func() {
+		rr.escape(string(text))
+		text = text[:0]
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case strings.HasPrefix(s[i:], "``"):
+			if j := u.index(s, i+2, "``"); j >= 0 {
+				flush()
+				rr.buf.WriteString("<code>")
+				rr.escape(s[i+2 : j])
+				rr.buf.WriteString("</code>")
+				i = j + 2
+				continue
+			}
+		case c == '`':
+			if m := rstLinkPat.FindStringSubmatch(s[i:]); m != nil {
+				flush()
+				label := m[1]
+				if label == "" {
+					label = m[2]
+				}
+				rr.link(rr.url(m[2], false), "", func() { rr.escape(label) })
+				i += len(m[0])
+				continue
+			}
+		case c == 'h' && (i == 0 || !isWordByte(s[i-1])):
+			if m := urlPat.FindString(s[i:]); m != "" {
+				flush()
+				rr.link(rr.url(m, false), "", func() { rr.escape(m) })
+				i += len(m)
+				continue
+			}
+		case c == '*' && (i == 0 || !isWordByte(s[i-1])):
+			n := 1
+			if i+1 < len(s) && s[i+1] == '*' {
+				n = 2
+			}
+			delim := s[i : i+n]
+			if j := u.emphasisEnd(s, i+n, delim); j > 0 {
+				flush()
+				tag := "em"
+				if n == 2 {
+					tag = "strong"
+				}
+				rr.buf.WriteString("<" + tag + ">")
+				rr.escape(s[i+n : j])
+				rr.buf.WriteString("</" + tag + ">")
+				i = j + n
+				continue
+			}
+		}
+		text = append(text, c)
+		i++
+	}
+	flush()
+}
@@ -0,0 +1,52 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/garyburd/gddo/doc"
+)
+
+const readmeURL = "https://github.com/user/repo/blob/master/README.md"
+
+var readmeTests = []struct {
+	name, text, html string
+}{
+	{"README", "a <b>\n\n", "<pre>a &lt;b&gt;</pre>\n"},
+	{"README.md", "Title\n=====\n\n## Sub ##\n", "<h4>Title</h4>\n<h5>Sub</h5>\n"},
+	{"README.md", "Hello *world* and **all**.\n<script>x</script>", "<p>Hello <em>world</em> and <strong>all</strong>.\n&lt;script&gt;x&lt;/script&gt;</p>\n"},
+	{"README.md", "Use `a<b` here.", "<p>Use <code>a&lt;b</code> here.</p>\n"},
+	{"README.md", "```go\nx := 1\n```\n\n    y := 2\n", "<pre>x := 1</pre>\n<pre>y := 2</pre>\n"},
+	{"README.md", "- one\n- two\n\n1. a\n2. b\n", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<ol>\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+	{"README.md", "> quote\n", "<blockquote>\n<p>quote</p>\n</blockquote>\n"},
+	{"README.md", "[doc](doc/x.md) [bad](javascript:alert(1)) [abs](http://example.com/)",
+		`<p><a href="https://github.com/user/repo/blob/master/doc/x.md" rel="nofollow">doc</a> bad <a href="http://example.com/" rel="nofollow">abs</a></p>` + "\n"},
+	{"README.md", "![logo](logo.png)", `<p><img src="https://github.com/user/repo/blob/master/logo.png?raw=true" alt="logo"></p>` + "\n"},
+	{"README.md", "See http://example.com/x.", `<p>See <a href="http://example.com/x" rel="nofollow">http://example.com/x</a>.</p>` + "\n"},
+	{"README.md", "snake_case_name", "<p>snake_case_name</p>\n"},
+	{"README.rst", "Title\n=====\n\nSub\n---\n\nText ``code`` and `link <http://example.com/>`_.\n", `<h4>Title</h4>` + "\n" + `<h5>Sub</h5>` + "\n" + `<p>Text <code>code</code> and <a href="http://example.com/" rel="nofollow">link</a>.</p>` + "\n"},
+	{"README.rst", "Example::\n\n    x := 1\n\n.. code-block:: go\n\n    y := 2\n", "<p>Example:</p>\n<pre>x := 1</pre>\n<pre>y := 2</pre>\n"},
+	{"README.rst", "* one\n* two\n\n.. comment\n   hidden\n", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+}
+
+func TestReadme(t *testing.T) {
+	for _, tt := range readmeTests {
+		actual := string(readmeFn(&doc.Readme{Name: tt.name, URL: readmeURL, Text: tt.text}))
+		if actual != tt.html {
+			t.Errorf("readme(%q, %q)\n got: %q\nwant: %q", tt.name, tt.text, actual, tt.html)
+		}
+	}
+}
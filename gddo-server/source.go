@@ -0,0 +1,142 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htemp "html/template"
+	"strings"
+
+	"github.com/garyburd/gddo/doc"
+)
+
+// annotatedSource returns the annotated source and the VCS browser URL for
+// the file with the given name. The returned code is nil if the source for
+// the file is not in the database.
+func annotatedSource(pdoc *doc.Package, name string) (*doc.Code, string, error) {
+	var file *doc.File
+	for _, files := range [][]*doc.File{pdoc.Files, pdoc.TestFiles} {
+		for _, f := range files {
+			if f.Name == name && f.Hash != "" {
+				file = f
+			}
+		}
+	}
+	if file == nil {
+		return nil, "", nil
+	}
+
+	// Fetch the package files to resolve references to declarations in
+	// other files.
+	files := []*doc.File{file}
+	for _, f := range pdoc.Files {
+		if f != file && f.Hash != "" {
+			files = append(files, f)
+		}
+	}
+	hashes := make([]string, len(files))
+	for i, f := range files {
+		hashes[i] = f.Hash
+	}
+	data, err := db.Source(hashes)
+	if err != nil {
+		return nil, "", err
+	}
+	if data[0] == nil {
+		return nil, "", nil
+	}
+	src := make(map[string][]byte)
+	for i, f := range files {
+		if data[i] != nil {
+			src[f.Name] = data[i]
+		}
+	}
+
+	code, err := doc.AnnotateSource(src, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return &code, file.URL, nil
+}
+
+// declFile returns the name of the file containing the declaration with
+// the given anchor.
+func declFile(pdoc *doc.Package, id string) string {
+	pos := declPos(pdoc, id)
+	if pos.Line == 0 || int(pos.File) >= len(pdoc.Files) {
+		return ""
+	}
+	return pdoc.Files[pos.File].Name
+}
+
+func valuesPos(values []*doc.Value, id string) (doc.Pos, bool) {
+	for _, v := range values {
+		for _, a := range v.Decl.Annotations {
+			if a.Kind == doc.AnchorAnnotation && v.Decl.Text[a.Pos:a.End] == id {
+				return v.Pos, true
+			}
+		}
+	}
+	return doc.Pos{}, false
+}
+
+func funcsPos(funcs []*doc.Func, prefix, id string) (doc.Pos, bool) {
+	for _, f := range funcs {
+		if prefix+f.Name == id {
+			return f.Pos, true
+		}
+	}
+	return doc.Pos{}, false
+}
+
+func declPos(pdoc *doc.Package, id string) doc.Pos {
+	if pos, ok := valuesPos(pdoc.Consts, id); ok {
+		return pos
+	}
+	if pos, ok := valuesPos(pdoc.Vars, id); ok {
+		return pos
+	}
+	if pos, ok := funcsPos(pdoc.Funcs, "", id); ok {
+		return pos
+	}
+	for _, t := range pdoc.Types {
+		if t.Name == id {
+			return t.Pos
+		}
+		if pos, ok := valuesPos(t.Consts, id); ok {
+			return pos
+		}
+		if pos, ok := valuesPos(t.Vars, id); ok {
+			return pos
+		}
+		if pos, ok := funcsPos(t.Funcs, "", id); ok {
+			return pos
+		}
+		if pos, ok := funcsPos(t.Methods, t.Name+".", id); ok {
+			return pos
+		}
+	}
+	return doc.Pos{}
+}
+
+// sourceFn formats annotated source as HTML with an anchor for each line.
+func sourceFn(c *doc.Code) htemp.HTML {
+	var buf bytes.Buffer
+	for i, line := range strings.Split(string(codeFn(*c, nil)), "\n") {
+		fmt.Fprintf(&buf, `<a class="line" id="L%d" href="#L%d">%5d</a>  %s`+"\n", i+1, i+1, i+1, line)
+	}
+	return htemp.HTML(buf.String())
+}
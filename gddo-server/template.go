@@ -21,7 +21,6 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	godoc "go/doc"
 	htemp "html/template"
 	"io"
 	"io/ioutil"
@@ -44,6 +43,10 @@ import (
 type tdoc struct {
 	*doc.Package
 	allExamples []*texample
+
+	// Doc link targets. See resolveDocLink.
+	declNames   map[string]bool
+	importNames map[string]string
 }
 
 type texample struct {
@@ -79,6 +82,119 @@ func (pdoc *tdoc) SourceLink(pos doc.Pos, text, anchor string) htemp.HTML {
 	return htemp.HTML(fmt.Sprintf(`<a title="View Source" href="%s">%s</a>`, u, text))
 }
 
+func (pdoc *tdoc) addAnchors(c doc.Code) {
+	for _, a := range c.Annotations {
+		if a.Kind != doc.AnchorAnnotation {
+			continue
+		}
+		name := c.Text[a.Pos:a.End]
+		if a.PathIndex >= 0 {
+			name = c.Paths[a.PathIndex] + "." + name
+		}
+		pdoc.declNames[name] = true
+	}
+}
+
+func (pdoc *tdoc) initDocLinks() {
+	pdoc.declNames = make(map[string]bool)
+	for _, v := range pdoc.Consts {
+		pdoc.addAnchors(v.Decl)
+	}
+	for _, v := range pdoc.Vars {
+		pdoc.addAnchors(v.Decl)
+	}
+	for _, f := range pdoc.Funcs {
+		pdoc.declNames[f.Name] = true
+	}
+	for _, t := range pdoc.Types {
+		pdoc.declNames[t.Name] = true
+		pdoc.addAnchors(t.Decl)
+		for _, v := range t.Consts {
+			pdoc.addAnchors(v.Decl)
+		}
+		for _, v := range t.Vars {
+			pdoc.addAnchors(v.Decl)
+		}
+		for _, f := range t.Funcs {
+			pdoc.declNames[f.Name] = true
+		}
+		for _, m := range t.Methods {
+			pdoc.declNames[t.Name+"."+m.Name] = true
+		}
+	}
+
+	pdoc.importNames = make(map[string]string)
+	for _, p := range pdoc.Imports {
+		if name := doc.GuessPackageName(p); name != "" {
+			pdoc.importNames[name] = p
+		}
+	}
+	if pdoc.Name != "" {
+		pdoc.importNames[pdoc.Name] = pdoc.ImportPath
+	}
+}
+
+// resolveDocLink returns the URL for the doc link [text] or "" if text is
+// not a declaration in the package or a reference to a package or a
+// declaration in a package.
+func (pdoc *tdoc) resolveDocLink(text string) string {
+	text = strings.TrimPrefix(text, "*")
+	if text == "" || strings.ContainsAny(text, " \t\n\"#?") {
+		return ""
+	}
+	if pdoc.declNames == nil {
+		pdoc.initDocLinks()
+	}
+	if pdoc.declNames[text] {
+		return "#" + text
+	}
+
+	importPath, name := text, ""
+	i := strings.LastIndex(text, "/") + 1
+	if j := strings.Index(text[i:], "."); j >= 0 {
+		importPath, name = text[:i+j], text[i+j+1:]
+	}
+	if p, ok := pdoc.importNames[importPath]; ok {
+		importPath = p
+	} else if !gosrc.IsGoRepoPath(importPath) && !(i > 0 && gosrc.IsValidRemotePath(importPath)) {
+		return ""
+	}
+	switch {
+	case importPath == pdoc.ImportPath && name != "":
+		if !pdoc.declNames[name] {
+			return ""
+		}
+		return "#" + name
+	case name != "":
+		return "/" + importPath + "#" + name
+	default:
+		return "/" + importPath
+	}
+}
+
+// Comment formats a comment in the package as HTML.
+func (pdoc *tdoc) Comment(v string) htemp.HTML {
+	return parseComment(v).HTML(pdoc.resolveDocLink)
+}
+
+// CommentText formats a comment in the package as text.
+func (pdoc *tdoc) CommentText(v string) string {
+	const indent = "    "
+	return parseComment(v).Text(pdoc.resolveDocLink, indent, "\t", 80-2*len(indent))
+}
+
+// CommentMarkdown formats a comment in the package as Markdown. Links to
+// other pages on the site are prefixed with origin.
+func (pdoc *tdoc) CommentMarkdown(v, origin string) string {
+	return parseComment(v).Markdown(func(text string) string {
+		u := pdoc.resolveDocLink(text)
+		if strings.HasPrefix(u, "/") {
+			u = origin + u
+		}
+		return u
+	})
+}
+
 func (pdoc *tdoc) PageName() string {
 	if pdoc.Name != "" && !pdoc.IsCmd {
 		return pdoc.Name
@@ -283,7 +399,6 @@ func importPathFn(path string) htemp.HTML {
 }
 
 var (
-	h3Pat      = regexp.MustCompile(`<h3 id="([^"]+)">([^<]+)</h3>`)
 	rfcPat     = regexp.MustCompile(`RFC\s+(\d{3,4})`)
 	packagePat = regexp.MustCompile(`\s+package\s+([-a-z0-9]\S+)`)
 )
@@ -305,53 +420,18 @@ func replaceAll(src []byte, re *regexp.Regexp, replace func(out, src []byte, m [
 	return append(out, src...)
 }
 
+// noDocLinks is the doc link resolver for comments outside of a package.
+func noDocLinks(string) string { return "" }
+
 // commentFn formats a source code comment as HTML.
 func commentFn(v string) htemp.HTML {
-	var buf bytes.Buffer
-	godoc.ToHTML(&buf, v, nil)
-	p := buf.Bytes()
-	p = replaceAll(p, h3Pat, func(out, src []byte, m []int) []byte {
-		out = append(out, `<h4 id="`...)
-		out = append(out, src[m[2]:m[3]]...)
-		out = append(out, `">`...)
-		out = append(out, src[m[4]:m[5]]...)
-		out = append(out, ` <a class="permalink" href="#`...)
-		out = append(out, src[m[2]:m[3]]...)
-		out = append(out, `">&para</a></h4>`...)
-		return out
-	})
-	p = replaceAll(p, rfcPat, func(out, src []byte, m []int) []byte {
-		out = append(out, `<a href="http://tools.ietf.org/html/rfc`...)
-		out = append(out, src[m[2]:m[3]]...)
-		out = append(out, `">`...)
-		out = append(out, src[m[0]:m[1]]...)
-		out = append(out, `</a>`...)
-		return out
-	})
-	p = replaceAll(p, packagePat, func(out, src []byte, m []int) []byte {
-		path := bytes.TrimRight(src[m[2]:m[3]], ".!?:")
-		if !gosrc.IsValidPath(string(path)) {
-			return append(out, src[m[0]:m[1]]...)
-		}
-		out = append(out, src[m[0]:m[2]]...)
-		out = append(out, `<a href="/`...)
-		out = append(out, path...)
-		out = append(out, `">`...)
-		out = append(out, path...)
-		out = append(out, `</a>`...)
-		out = append(out, src[m[2]+len(path):m[1]]...)
-		return out
-	})
-	return htemp.HTML(p)
+	return parseComment(v).HTML(noDocLinks)
 }
 
 // commentTextFn formats a source code comment as text.
 func commentTextFn(v string) string {
 	const indent = "    "
-	var buf bytes.Buffer
-	godoc.ToText(&buf, v, indent, "\t", 80-2*len(indent))
-	p := buf.Bytes()
-	return string(p)
+	return parseComment(v).Text(noDocLinks, indent, "\t", 80-2*len(indent))
 }
 
 var period = []byte{'.'}
@@ -387,9 +467,19 @@ func codeFn(c doc.Code, typ *doc.Type) htemp.HTML {
 			buf.WriteString(`<span class="com">`)
 			htemp.HTMLEscape(&buf, src[a.Pos:a.End])
 			buf.WriteString(`</span>`)
+		case doc.FileLinkAnnotation:
+			buf.WriteString(`<a href="`)
+			u := url.URL{RawQuery: "file=" + url.QueryEscape(c.Paths[a.PathIndex]), Fragment: fmt.Sprintf("L%d", a.Line)}
+			htemp.HTMLEscape(&buf, []byte(u.String()))
+			buf.WriteString(`">`)
+			htemp.HTMLEscape(&buf, src[a.Pos:a.End])
+			buf.WriteString(`</a>`)
 		case doc.AnchorAnnotation:
 			buf.WriteString(`<span id="`)
-			if typ != nil {
+			if a.PathIndex >= 0 {
+				htemp.HTMLEscape(&buf, []byte(c.Paths[a.PathIndex]))
+				buf.WriteByte('.')
+			} else if typ != nil {
 				htemp.HTMLEscape(&buf, []byte(typ.Name))
 				buf.WriteByte('.')
 			}
@@ -408,6 +498,11 @@ func codeFn(c doc.Code, typ *doc.Type) htemp.HTML {
 
 var gaAccount string
 
+// readmeFn returns the HTML for a README.
+func readmeFn(r *doc.Readme) htemp.HTML {
+	return htemp.HTML(renderReadme(r))
+}
+
 func gaAccountFn() string {
 	return gaAccount
 }
@@ -416,6 +511,11 @@ func noteTitleFn(s string) string {
 	return strings.Title(strings.ToLower(s))
 }
 
+// percentFn formats a fraction as a percentage.
+func percentFn(f float64) string {
+	return fmt.Sprintf("%.0f%%", 100*f)
+}
+
 func htmlCommentFn(s string) htemp.HTML {
 	return htemp.HTML("<!-- " + s + " -->")
 }
@@ -423,6 +523,7 @@ func htmlCommentFn(s string) htemp.HTML {
 var contentTypes = map[string]string{
 	".html": "text/html; charset=utf-8",
 	".txt":  "text/plain; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
 }
 
 func executeTemplate(resp web.Response, name string, status int, header web.Header, data interface{}) error {
@@ -474,6 +575,8 @@ func parseHTMLTemplates(sets [][]string) error {
 			"isValidImportPath": gosrc.IsValidPath,
 			"map":               mapFn,
 			"noteTitle":         noteTitleFn,
+			"percent":           percentFn,
+			"readme":            readmeFn,
 			"relativePath":      relativePathFn,
 			"staticFile":        staticFileFn,
 			"templateName":      func() string { return templateName },
@@ -490,12 +593,16 @@ func parseHTMLTemplates(sets [][]string) error {
 	return nil
 }
 
+var textTemplateFuncs = ttemp.FuncMap{
+	"comment":        commentTextFn,
+	"map":            mapFn,
+	"markdownEscape": markdownEscape,
+}
+
 func parseTextTemplates(sets [][]string) error {
 	for _, set := range sets {
 		t := ttemp.New("")
-		t.Funcs(ttemp.FuncMap{
-			"comment": commentTextFn,
-		})
+		t.Funcs(textTemplateFuncs)
 		if _, err := t.ParseFiles(joinTemplateDir(*assetsDir, set)...); err != nil {
 			return err
 		}
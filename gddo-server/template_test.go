@@ -0,0 +1,53 @@
+// Copyright 2013 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	ttemp "text/template"
+
+	"github.com/garyburd/gddo/doc"
+)
+
+func TestMarkdownExamples(t *testing.T) {
+	tmpl, err := ttemp.New("").Funcs(textTemplateFuncs).ParseFiles(joinTemplateDir("assets", []string{"common.md"})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples := []*texample{{Example: &doc.Example{
+		Doc:  "This example uses F.\n\n\tindented\n",
+		Code: doc.Code{Text: "foo.F()"},
+	}}}
+	var buf bytes.Buffer
+	err = tmpl.ExecuteTemplate(&buf, "Examples", map[string]interface{}{
+		"examples": examples,
+		"root":     map[string]interface{}{"pdoc": commentTestDoc, "origin": "http://example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"\n\nThis example uses F.\n",
+		"\n```\nindented\n```\n",
+		"```go\nfoo.F()\n```",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Examples output does not contain %q:\n%s", want, out)
+		}
+	}
+}